@@ -34,6 +34,14 @@ func (a Aggregate) EQ(val any) Predicate {
 	}
 }
 
+func (a Aggregate) NE(val any) Predicate {
+	return Predicate{
+		left:  a,
+		op:    opNE,
+		right: ValueOf(val),
+	}
+}
+
 func (a Aggregate) LT(val any) Predicate {
 	return Predicate{
 		left:  a,
@@ -66,6 +74,66 @@ func (a Aggregate) GE(val any) Predicate {
 	}
 }
 
+func (a Aggregate) Like(pattern any) Predicate {
+	return Predicate{
+		left:  a,
+		op:    opLike,
+		right: ValueOf(pattern),
+	}
+}
+
+func (a Aggregate) NotLike(pattern any) Predicate {
+	return Predicate{
+		left:  a,
+		op:    opNotLike,
+		right: ValueOf(pattern),
+	}
+}
+
+// Between 生成 BETWEEN low AND high，区间包含两端
+func (a Aggregate) Between(low, high any) Predicate {
+	return Predicate{
+		left: a,
+		op:   opBetween,
+		right: betweenRange{
+			low:  ValueOf(low),
+			high: ValueOf(high),
+		},
+	}
+}
+
+func (a Aggregate) IsNull() Predicate {
+	return Predicate{
+		left: a,
+		op:   opIsNull,
+	}
+}
+
+func (a Aggregate) IsNotNull() Predicate {
+	return Predicate{
+		left: a,
+		op:   opIsNotNull,
+	}
+}
+
+// In 传入单个切片时会展开成多个占位符
+// Count("Id").In(1, 2, 3) 或者 Count("Id").In(counts)
+func (a Aggregate) In(vals ...any) Predicate {
+	return Predicate{
+		left:  a,
+		op:    opIN,
+		right: valuesOf(vals),
+	}
+}
+
+func (a Aggregate) NotIn(vals ...any) Predicate {
+	return Predicate{
+		left:  a,
+		op:    opNotIN,
+		right: valuesOf(vals),
+	}
+}
+
 func Count(arg string) Aggregate {
 	return Aggregate{
 		fn:  "COUNT",
@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"context"
 	"errors"
 	"github.com/uzziahlin/orm/internal/errs"
 	"github.com/uzziahlin/orm/model"
@@ -15,6 +16,54 @@ type Builder struct {
 	args    []any
 	sess    Session
 	quoter  byte
+	// argOffset 作为子查询时外层查询已经使用的参数个数，用来生成编号占位符
+	argOffset int
+	// nested 作为子查询构造，全表保护只检查最外层的语句
+	nested bool
+	// allowFullTable 调用了 AllowFullTable，不做全表保护
+	allowFullTable bool
+	// tables 构造语句时用到的表
+	tables []string
+	// mdls 通过 Use 设置的 middleware，只作用于这一次查询
+	mdls []MiddleWare
+}
+
+// tablesReferrer 返回构造语句时用到的表
+type tablesReferrer interface {
+	referencedTables() []string
+}
+
+func (s *Builder) referencedTables() []string {
+	return s.tables
+}
+
+// quoteTable 写入表名并记录下来
+func (s *Builder) quoteTable(name string) {
+	s.tables = append(s.tables, name)
+	s.quote(name)
+}
+
+// argOffsetSetter 子查询需要接着外层查询的参数编号生成占位符
+type argOffsetSetter interface {
+	setArgOffset(offset int)
+}
+
+func (s *Builder) setArgOffset(offset int) {
+	s.argOffset = offset
+}
+
+// nestedSetter 标记语句作为子查询构造
+type nestedSetter interface {
+	setNested(nested bool)
+}
+
+func (s *Builder) setNested(nested bool) {
+	s.nested = nested
+}
+
+// session 执行语句时使用的 Session，会优先使用 ctx 里面的事务
+func (s *Builder) session(ctx context.Context) Session {
+	return resolveSession(ctx, s.sess)
 }
 
 func (s *Builder) quote(name string) {
@@ -62,7 +111,10 @@ func (s *Builder) buildExpression(expr Expression) error {
 		if elem.op != "" {
 			s.builder.WriteString(" ")
 			s.builder.WriteString(elem.op.String())
-			s.builder.WriteString(" ")
+			// IS NULL 这类后缀操作符右边没有表达式
+			if elem.right != nil {
+				s.builder.WriteString(" ")
+			}
 		}
 
 		_, ok = elem.right.(Predicate)
@@ -86,11 +138,31 @@ func (s *Builder) buildExpression(expr Expression) error {
 			return err
 		}
 	case Value:
-		s.builder.WriteString(" ? ")
-		s.addArgs(elem.val)
+		s.builder.WriteByte(' ')
+		s.buildPlaceholder(elem.val)
+		s.builder.WriteByte(' ')
+	case valueList:
+		if len(elem.vals) == 0 {
+			return errs.ErrEmptyValueList
+		}
+		s.builder.WriteByte('(')
+		for idx, val := range elem.vals {
+			if idx > 0 {
+				s.builder.WriteByte(',')
+			}
+			s.buildPlaceholder(val)
+		}
+		s.builder.WriteByte(')')
+	case betweenRange:
+		if err := s.buildExpression(elem.low); err != nil {
+			return err
+		}
+		s.builder.WriteString(" AND ")
+		if err := s.buildExpression(elem.high); err != nil {
+			return err
+		}
 	case RawExpr:
-		s.builder.WriteString(elem.exp)
-		s.addArgs(elem.args...)
+		s.buildRaw(elem)
 	case Aggregate:
 		err := s.buildAggregate(elem)
 
@@ -111,10 +183,21 @@ func (s *Builder) buildExpression(expr Expression) error {
 }
 
 func (s *Builder) buildSubQuery(sub SubQuery) error {
+	if b, ok := sub.b.(argOffsetSetter); ok {
+		b.setArgOffset(s.argOffset + len(s.args))
+		defer b.setArgOffset(0)
+	}
+	if b, ok := sub.b.(nestedSetter); ok {
+		b.setNested(true)
+		defer b.setNested(false)
+	}
 	stat, err := sub.b.Build()
 	if err != nil {
 		return err
 	}
+	if r, ok := sub.b.(tablesReferrer); ok {
+		s.tables = append(s.tables, r.referencedTables()...)
+	}
 	s.builder.WriteByte('(')
 	s.builder.WriteString(stat.Sql)
 	s.builder.WriteByte(')')
@@ -126,6 +209,26 @@ func (s *Builder) buildSubQuery(sub SubQuery) error {
 	return nil
 }
 
+// buildPlaceholder 写入方言的占位符并记录参数
+func (s *Builder) buildPlaceholder(val any) {
+	s.addArgs(val)
+	s.builder.WriteString(s.dialect.placeholder(s.argOffset + len(s.args)))
+}
+
+// buildRaw 把原生表达式里的 ? 按顺序替换成方言的占位符
+func (s *Builder) buildRaw(raw RawExpr) {
+	argIdx := 0
+	for i := 0; i < len(raw.exp); i++ {
+		if raw.exp[i] == '?' && argIdx < len(raw.args) {
+			s.buildPlaceholder(raw.args[argIdx])
+			argIdx++
+			continue
+		}
+		s.builder.WriteByte(raw.exp[i])
+	}
+	s.addArgs(raw.args[argIdx:]...)
+}
+
 func (s *Builder) addArgs(args ...any) {
 	if len(args) == 0 {
 		return
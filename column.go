@@ -68,6 +68,14 @@ func (c Column) EQ(val any) Predicate {
 	}
 }
 
+func (c Column) NE(val any) Predicate {
+	return Predicate{
+		left:  c,
+		op:    opNE,
+		right: ValueOf(val),
+	}
+}
+
 func (c Column) LT(val any) Predicate {
 	return Predicate{
 		left:  c,
@@ -100,6 +108,66 @@ func (c Column) GE(val any) Predicate {
 	}
 }
 
+func (c Column) Like(pattern any) Predicate {
+	return Predicate{
+		left:  c,
+		op:    opLike,
+		right: ValueOf(pattern),
+	}
+}
+
+func (c Column) NotLike(pattern any) Predicate {
+	return Predicate{
+		left:  c,
+		op:    opNotLike,
+		right: ValueOf(pattern),
+	}
+}
+
+// Between 生成 BETWEEN low AND high，区间包含两端
+func (c Column) Between(low, high any) Predicate {
+	return Predicate{
+		left: c,
+		op:   opBetween,
+		right: betweenRange{
+			low:  ValueOf(low),
+			high: ValueOf(high),
+		},
+	}
+}
+
+func (c Column) IsNull() Predicate {
+	return Predicate{
+		left: c,
+		op:   opIsNull,
+	}
+}
+
+func (c Column) IsNotNull() Predicate {
+	return Predicate{
+		left: c,
+		op:   opIsNotNull,
+	}
+}
+
+// In 传入单个切片时会展开成多个占位符
+// C("Id").In(1, 2, 3) 或者 C("Id").In(ids)
+func (c Column) In(vals ...any) Predicate {
+	return Predicate{
+		left:  c,
+		op:    opIN,
+		right: valuesOf(vals),
+	}
+}
+
+func (c Column) NotIn(vals ...any) Predicate {
+	return Predicate{
+		left:  c,
+		op:    opNotIN,
+		right: valuesOf(vals),
+	}
+}
+
 func ValueOf(val any) Expression {
 	switch v := val.(type) {
 	case Expression:
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"github.com/uzziahlin/orm/internal/valuer"
 	"github.com/uzziahlin/orm/model"
+	"log"
 )
 
 type DBOption func(db *DB)
@@ -13,6 +14,8 @@ type DBOption func(db *DB)
 type DB struct {
 	core
 	*sql.DB
+	// txHookPanic 处理事务钩子里面的 panic
+	txHookPanic func(ctx context.Context, r any)
 }
 
 func (db *DB) getCore() core {
@@ -32,7 +35,36 @@ func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Tx{tx: tx, db: db}, nil
+	return &Tx{tx: tx, db: db, ctx: ctx}, nil
+}
+
+// DoTx 在事务中执行 fn，fn 返回 nil 时提交，返回 error 时回滚
+// fn panic 时先回滚再重新 panic，回滚失败的错误会和 fn 的错误合并返回
+// ctx 里面已经有这个 DB 开启的事务时，通过保存点开启嵌套事务，opts 和重试策略会被忽略
+// 使用 TxWithRetry 时，可重试的错误会导致整个事务重新执行，fn 需要能够重复执行
+func (db *DB) DoTx(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context, tx *Tx) error, txOpts ...TxOption) error {
+	if tx, ok := TxFromContext(ctx); ok && tx.db == db {
+		return tx.DoTx(ctx, fn)
+	}
+
+	var o txOptions
+	for _, opt := range txOpts {
+		opt(&o)
+	}
+
+	once := func() error {
+		tx, err := db.BeginTx(ctx, opts)
+		if err != nil {
+			return err
+		}
+		return doTx(ctx, tx, fn)
+	}
+
+	if o.retry == nil {
+		return once()
+	}
+
+	return doTxWithRetry(ctx, *o.retry, once)
 }
 
 func Open(driverName, dsn string, opts ...DBOption) (*DB, error) {
@@ -43,6 +75,9 @@ func Open(driverName, dsn string, opts ...DBOption) (*DB, error) {
 		return nil, err
 	}
 
+	// 根据驱动名选择方言，用户传入的 DBWithDialect 会覆盖它
+	opts = append([]DBOption{DBWithDialect(dialectOf(driverName))}, opts...)
+
 	return OpenDB(db, opts...)
 
 }
@@ -53,15 +88,20 @@ func OpenDB(db *sql.DB, opts ...DBOption) (*DB, error) {
 		core: core{
 			registry: model.NewRegistry(),
 			creator:  valuer.NewUnsafeValuer,
-			dialect:  &mysqlDialect{},
+			dialect:  MySQL,
 		},
 		DB: db,
+		txHookPanic: func(ctx context.Context, r any) {
+			log.Printf("orm: 事务钩子 panic: %v", r)
+		},
 	}
 
 	for _, opt := range opts {
 		opt(res)
 	}
 
+	res.registry = newHookRegistry(res.registry)
+
 	return res, nil
 }
 
@@ -77,8 +117,38 @@ func DBWithCreator(creator valuer.Creator) DBOption {
 	}
 }
 
+func DBWithDialect(d Dialect) DBOption {
+	return func(db *DB) {
+		db.dialect = d
+	}
+}
+
+// DBWithTxHookPanicHandler 指定如何处理 OnCommit 和 OnRollback 钩子里面的 panic，默认输出日志
+func DBWithTxHookPanicHandler(handler func(ctx context.Context, r any)) DBOption {
+	return func(db *DB) {
+		db.txHookPanic = handler
+	}
+}
+
+// DBWithFullTableGuard 构造语句时拒绝没有 WHERE 的 UPDATE、DELETE 以及大表上没有 LIMIT 的 SELECT，
+// 返回 *FullTableError，确实需要操作整张表时调用 AllowFullTable
+func DBWithFullTableGuard() DBOption {
+	return func(db *DB) {
+		db.fullTableGuard = true
+	}
+}
+
+// DBWithQueryErrorArgs QueryError 中保留语句的参数，参数可能包含敏感数据，默认不保留
+func DBWithQueryErrorArgs() DBOption {
+	return func(db *DB) {
+		db.queryErrorArgs = true
+	}
+}
+
+// DBWithMiddlewares 追加作用于所有查询的 middleware，后面的在外层，先执行。
+// 只作用于某一次查询的 middleware 使用 Selector、Inserter 等的 Use，它们包在这些 middleware 的外面
 func DBWithMiddlewares(mdls ...MiddleWare) DBOption {
 	return func(db *DB) {
-		db.mdls = mdls
+		db.mdls = append(db.mdls, mdls...)
 	}
 }
@@ -0,0 +1,102 @@
+package orm
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestOpen_Dialect(t *testing.T) {
+	testCases := []struct {
+		name        string
+		driverName  string
+		opts        []DBOption
+		wantDialect Dialect
+	}{
+		{
+			name:        "sqlite3",
+			driverName:  "sqlite3",
+			wantDialect: SQLite3,
+		},
+		{
+			name:        "given dialect",
+			driverName:  "sqlite3",
+			opts:        []DBOption{DBWithDialect(Standard)},
+			wantDialect: Standard,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := Open(tc.driverName, "file:open_dialect?mode=memory", tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.wantDialect, db.dialect)
+		})
+	}
+
+	assert.Equal(t, MySQL, dialectOf("mysql"))
+	assert.Equal(t, Postgres, dialectOf("postgres"))
+	assert.Equal(t, Postgres, dialectOf("pgx"))
+}
+
+func TestSQLite3_InsertAndGet(t *testing.T) {
+	db, err := Open("sqlite3", "file:sqlite3_insert_get?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE "auto_increment_model"("id" INTEGER PRIMARY KEY AUTOINCREMENT, "name" TEXT)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vals := []*AutoIncrementModel{{Name: "Jack"}, {Name: "Tom"}}
+	_, err = NewInserter[AutoIncrementModel](db).Values(vals...).Exec(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []*AutoIncrementModel{{Id: 1, Name: "Jack"}, {Id: 2, Name: "Tom"}}, vals)
+
+	res, err := NewSelector[AutoIncrementModel](db).Where(C("Name").EQ("Tom")).Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &AutoIncrementModel{Id: 2, Name: "Tom"}, res)
+}
+
+func TestSQLite3_Upsert(t *testing.T) {
+	db, err := Open("sqlite3", "file:sqlite3_upsert?mode=memory&cache=shared")
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE "auto_increment_model"("id" INTEGER PRIMARY KEY AUTOINCREMENT, "name" TEXT UNIQUE)`)
+	require.NoError(t, err)
+
+	_, err = NewInserter[AutoIncrementModel](db).Values(&AutoIncrementModel{Name: "Jack"}, &AutoIncrementModel{Name: "Tom"}).Exec(ctx)
+	require.NoError(t, err)
+
+	// 走了更新分支，回填的是这一行自己的主键，而不是连接上一次插入的
+	val := &AutoIncrementModel{Name: "Jack"}
+	_, err = NewInserter[AutoIncrementModel](db).Values(val).
+		OnDuplicateKey().ConflictColumns("Name").Update(C("Name")).Exec(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &AutoIncrementModel{Id: 1, Name: "Jack"}, val)
+
+	val = &AutoIncrementModel{Name: "Ken"}
+	_, err = NewInserter[AutoIncrementModel](db).Values(val).
+		OnDuplicateKey().ConflictColumns("Name").Update(C("Name")).Exec(ctx)
+	require.NoError(t, err)
+
+	// 自增序列在冲突时也可能被消耗，以数据库里的为准
+	res, err := NewSelector[AutoIncrementModel](db).Where(C("Name").EQ("Ken")).Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, res, val)
+}
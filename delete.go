@@ -1,23 +1,38 @@
 package orm
 
 import (
+	"context"
+	"github.com/uzziahlin/orm/internal/errs"
+	"github.com/uzziahlin/orm/model"
 	"strings"
 )
 
 type Deleter[T any] struct {
 	Builder
+	val   *T
 	where []Predicate
 }
 
 func NewDeleter[T any](sess Session) *Deleter[T] {
+
+	c := sess.getCore()
+
 	builder := Builder{
-		sess: sess,
+		sess:   sess,
+		core:   c,
+		quoter: c.dialect.quoter(),
 	}
 	return &Deleter[T]{
 		Builder: builder,
 	}
 }
 
+// Delete 指定要删除的实体，执行前在它上面调用 BeforeDeleteHook，删除哪些行仍然由 Where 决定
+func (d *Deleter[T]) Delete(entity *T) *Deleter[T] {
+	d.val = entity
+	return d
+}
+
 func (d *Deleter[T]) From(table TableReference) *Deleter[T] {
 	d.table = table
 	return d
@@ -28,6 +43,18 @@ func (d *Deleter[T]) Where(conds ...Predicate) *Deleter[T] {
 	return d
 }
 
+// Use 添加只作用于这一次查询的 middleware，它们包在 DBWithMiddlewares 设置的 middleware 外面
+func (d *Deleter[T]) Use(mdls ...MiddleWare) *Deleter[T] {
+	d.mdls = append(d.mdls, mdls...)
+	return d
+}
+
+// AllowFullTable 允许执行没有 WHERE 的删除
+func (d *Deleter[T]) AllowFullTable() *Deleter[T] {
+	d.allowFullTable = true
+	return d
+}
+
 func (d *Deleter[T]) Build() (*Stat, error) {
 	var (
 		t   T
@@ -40,44 +67,82 @@ func (d *Deleter[T]) Build() (*Stat, error) {
 	}
 
 	d.builder = &strings.Builder{}
+	d.tables = nil
 
-	d.builder.WriteString("delete from ")
+	defer func() {
+		d.builder.Reset()
+		d.args = nil
+	}()
 
-	d.buildFrom()
+	d.builder.WriteString("DELETE FROM ")
 
-	if len(d.where) > 0 {
-		err := d.BuildPredicates()
+	if err = d.buildFrom(); err != nil {
+		return nil, err
+	}
 
-		if err != nil {
+	if len(d.where) > 0 {
+		d.builder.WriteString(" WHERE ")
+		if err = d.BuildPredicates(d.where...); err != nil {
 			return nil, err
 		}
 	}
 
-	return &Stat{
+	stat := &Stat{
 		Sql:  d.builder.String(),
 		Args: d.args,
-	}, nil
+	}
 
+	if err = d.checkFullTable(OpDelete, d, stat); err != nil {
+		return nil, err
+	}
+
+	return stat, nil
+}
+
+func (d *Deleter[T]) fullTable(meta *model.Model) bool {
+	return !d.allowFullTable && len(d.where) == 0
 }
 
-func (d *Deleter[T]) Exec() (Result, error) {
-	//TODO implement me
-	panic("implement me")
+func (d *Deleter[T]) Exec(ctx context.Context) (Result, error) {
+	var t T
+
+	meta, err := d.registry.Get(&t)
+
+	if err != nil {
+		return nil, err
+	}
+
+	qc := &QueryContext{
+		Type:    OpDelete,
+		builder: d,
+		Model:   meta,
+	}
+
+	if d.val != nil && meta.Hooks.Has(model.HookBeforeDelete) {
+		if err = any(d.val).(BeforeDeleteHook).BeforeDelete(ctx, d.session(ctx)); err != nil {
+			return nil, d.hookError(qc, err)
+		}
+	}
+
+	return d.exec(ctx, qc)
 }
 
-func (d *Deleter[T]) buildFrom() {
+func (d *Deleter[T]) buildFrom() error {
 	switch tab := d.table.(type) {
 	case Table:
 		meta, err := d.registry.Get(tab.entity)
 		if err != nil {
-			return
+			return err
 		}
-		d.builder.WriteString(meta.TabName)
+		d.quoteTable(meta.TabName)
 		if tab.alias != "" {
 			d.builder.WriteString(" AS ")
-			d.builder.WriteString(tab.alias)
+			d.quote(tab.alias)
 		}
 	case nil:
-		d.builder.WriteString(d.meta.TabName)
+		d.quoteTable(d.meta.TabName)
+	default:
+		return errs.NewErrUnsupportedTableType(tab)
 	}
+	return nil
 }
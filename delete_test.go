@@ -1,17 +1,19 @@
 package orm
 
 import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/uzziahlin/orm/internal/errs"
 	"testing"
 )
 
 func TestDeleter_Build(t *testing.T) {
 
-	db, err := Open("", "")
+	db := memoryDB(t, DBWithDialect(MySQL))
 
-	if err != nil {
-		return
-	}
+	join := TableOf(&Order{}).Join(TableOf(&OrderDetail{})).Using("Id")
 
 	testCases := []struct {
 		name     string
@@ -23,20 +25,32 @@ func TestDeleter_Build(t *testing.T) {
 			name:    "normal",
 			builder: NewDeleter[TestModel](db),
 			wantStat: &Stat{
-				Sql: "delete from test_model",
+				Sql: "DELETE FROM `test_model`",
+			},
+		},
+		{
+			name:    "from",
+			builder: NewDeleter[TestModel](db).From(TableOf(&TestModel1{})),
+			wantStat: &Stat{
+				Sql: "DELETE FROM `test_model_1`",
 			},
 		},
 		{
 			name:    "where",
 			builder: NewDeleter[TestModel](db).Where(C("Name").EQ("Jack").AND(C("Age").LT(18))),
 			wantStat: &Stat{
-				Sql: "delete from test_model where (`name` =  ? ) AND (`age` <  ? )",
+				Sql: "DELETE FROM `test_model` WHERE (`name` =  ? ) AND (`age` <  ? )",
 				Args: []any{
 					"Jack",
 					18,
 				},
 			},
 		},
+		{
+			name:    "unsupported table",
+			builder: NewDeleter[TestModel](db).From(join),
+			wantErr: errs.NewErrUnsupportedTableType(join),
+		},
 	}
 
 	for _, tc := range testCases {
@@ -53,3 +67,65 @@ func TestDeleter_Build(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleter_Exec(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = mockDB.Close() }()
+
+	testCases := []struct {
+		name         string
+		mockErr      error
+		mockRes      Result
+		wantErr      error
+		wantAffected int64
+	}{
+		{
+			name:    "exec error",
+			mockErr: errors.New("invalid exec"),
+			wantErr: errors.New("invalid exec"),
+		},
+		{
+			name:         "exec",
+			mockRes:      sqlmock.NewResult(0, 2),
+			wantAffected: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		exp := mock.ExpectExec("DELETE FROM `test_model` WHERE .*")
+		if tc.mockErr != nil {
+			exp.WillReturnError(tc.mockErr)
+		} else {
+			exp.WillReturnResult(tc.mockRes)
+		}
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var types []string
+			db, err := OpenDB(mockDB, DBWithMiddlewares(func(next HandleFunc) HandleFunc {
+				return func(ctx context.Context, qc *QueryContext) *QueryResult {
+					types = append(types, qc.Type)
+					return next(ctx, qc)
+				}
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := NewDeleter[TestModel](db).Where(C("Name").EQ("Jack")).Exec(context.Background())
+			assert.Equal(t, []string{"DELETE"}, types)
+			assert.Equal(t, tc.wantErr, queryErrCause(err))
+			if err != nil {
+				return
+			}
+			affected, err := res.RowsAffected()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantAffected, affected)
+		})
+	}
+}
@@ -1,16 +1,57 @@
 package orm
 
-import "github.com/uzziahlin/orm/internal/errs"
+import (
+	"github.com/uzziahlin/orm/internal/errs"
+	"regexp"
+	"strconv"
+	"strings"
+)
 
 var (
 	_ Dialect = &mysqlDialect{}
 	_ Dialect = &sqlite3Dialect{}
+	_ Dialect = &postgresDialect{}
+)
+
+var (
+	MySQL    Dialect = &mysqlDialect{}
+	SQLite3  Dialect = &sqlite3Dialect{}
+	Postgres Dialect = &postgresDialect{}
+	// Standard 标准SQL，在没有专门方言的数据库上使用
+	Standard Dialect = &standardSQLDialect{}
 )
 
+// dialectOf 根据驱动名选择方言，未知驱动使用 MySQL
+func dialectOf(driverName string) Dialect {
+	switch driverName {
+	case "sqlite3":
+		return SQLite3
+	case "postgres", "pgx":
+		return Postgres
+	default:
+		return MySQL
+	}
+}
+
 // Dialect 对数据库方言的抽象，因为有些sql语法在不同的方言会有不同实现
 type Dialect interface {
 	quoter() byte
+	// placeholder 第 idx 个参数的占位符，idx 从 1 开始
+	placeholder(idx int) string
+	// supportReturning 是否支持 INSERT ... RETURNING
+	supportReturning() bool
 	buildUpsert(i *Builder, upsert *Upsert) error
+	// savepoint 创建保存点的语句，用来实现嵌套事务
+	savepoint(name string) string
+	// releaseSavepoint 释放保存点的语句，相当于提交嵌套事务
+	releaseSavepoint(name string) string
+	// rollbackToSavepoint 回滚到保存点的语句，相当于回滚嵌套事务
+	rollbackToSavepoint(name string) string
+	// insertIds 根据 LastInsertId 推算一次插入 rows 行时每行的自增主键，无法推算时返回 false。
+	// upsert 时要能区分插入和更新，否则可能把别的行的主键写进实体
+	insertIds(lastId int64, rows int, upsert bool) ([]int64, bool)
+	// translateErr 把驱动错误翻译成 *ConstraintError，不认识的错误原样返回
+	translateErr(err error) error
 }
 
 type mysqlDialect struct {
@@ -38,7 +79,9 @@ func (m mysqlDialect) buildUpsert(b *Builder, odk *Upsert) error {
 				return err
 			}
 			b.builder.WriteString("=")
-			return b.buildExpression(assign.val)
+			if err = b.buildExpression(assign.val); err != nil {
+				return err
+			}
 		default:
 			return errs.NewErrUnsupportedAssignableType(a)
 		}
@@ -50,14 +93,56 @@ func (m mysqlDialect) quoter() byte {
 	return '`'
 }
 
+func (m mysqlDialect) placeholder(idx int) string {
+	return "?"
+}
+
+func (m mysqlDialect) supportReturning() bool {
+	return false
+}
+
+func (m mysqlDialect) savepoint(name string) string {
+	return "SAVEPOINT " + name
+}
+
+func (m mysqlDialect) releaseSavepoint(name string) string {
+	return "RELEASE SAVEPOINT " + name
+}
+
+func (m mysqlDialect) rollbackToSavepoint(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+
+// insertIds MySQL 的 LastInsertId 是批量插入中第一行的主键，upsert 走了更新分支时为 0。
+// 假设同一条语句插入的主键是连续的，auto_increment_increment 不是 1 时推算的结果不对
+func (m mysqlDialect) insertIds(lastId int64, rows int, upsert bool) ([]int64, bool) {
+	if lastId == 0 {
+		return nil, false
+	}
+	ids := make([]int64, rows)
+	for i := range ids {
+		ids[i] = lastId + int64(i)
+	}
+	return ids, true
+}
+
 type standardSQLDialect struct {
 }
 
 func (s standardSQLDialect) buildUpsert(b *Builder, odk *Upsert) error {
 	b.builder.WriteString(" ON CONFLICT")
-	if len(odk.conflictColumns) > 0 {
+
+	// 没有指定冲突列时默认使用主键
+	conflictColumns := odk.conflictColumns
+	if len(conflictColumns) == 0 {
+		for _, pk := range b.meta.PrimaryKeys {
+			conflictColumns = append(conflictColumns, pk.GoName)
+		}
+	}
+
+	if len(conflictColumns) > 0 {
 		b.builder.WriteByte('(')
-		for i, col := range odk.conflictColumns {
+		for i, col := range conflictColumns {
 			if i > 0 {
 				b.builder.WriteByte(',')
 			}
@@ -81,7 +166,7 @@ func (s standardSQLDialect) buildUpsert(b *Builder, odk *Upsert) error {
 				return err
 			}
 			b.quote(colName)
-			b.builder.WriteString("=excluded.")
+			b.builder.WriteString("=EXCLUDED.")
 			b.quote(colName)
 		case Assignment:
 			err := b.buildColumn(C(assign.column))
@@ -89,7 +174,9 @@ func (s standardSQLDialect) buildUpsert(b *Builder, odk *Upsert) error {
 				return err
 			}
 			b.builder.WriteString("=")
-			return b.buildExpression(assign.val)
+			if err = b.buildExpression(assign.val); err != nil {
+				return err
+			}
 		default:
 			return errs.NewErrUnsupportedAssignableType(a)
 		}
@@ -98,9 +185,199 @@ func (s standardSQLDialect) buildUpsert(b *Builder, odk *Upsert) error {
 }
 
 func (s standardSQLDialect) quoter() byte {
-	return '`'
+	return '"'
+}
+
+func (s standardSQLDialect) placeholder(idx int) string {
+	return "?"
+}
+
+func (s standardSQLDialect) supportReturning() bool {
+	return false
+}
+
+func (s standardSQLDialect) savepoint(name string) string {
+	return "SAVEPOINT " + name
+}
+
+func (s standardSQLDialect) releaseSavepoint(name string) string {
+	return "RELEASE SAVEPOINT " + name
+}
+
+func (s standardSQLDialect) rollbackToSavepoint(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+
+// insertIds 标准SQL没有约定批量插入的主键，只支持单行；
+// 也没有约定 upsert 走更新分支时的 LastInsertId，例如 SQLite 会保留连接上一次插入的值，所以 upsert 不回填
+func (s standardSQLDialect) insertIds(lastId int64, rows int, upsert bool) ([]int64, bool) {
+	if rows != 1 || upsert {
+		return nil, false
+	}
+	return []int64{lastId}, true
 }
 
 type sqlite3Dialect struct {
 	standardSQLDialect
 }
+
+// supportReturning SQLite 3.35 开始支持 RETURNING，go-sqlite3 自带的版本满足要求。
+// 自增主键通过 RETURNING 回填，upsert 走更新分支时拿到的也是那一行真正的主键
+func (s sqlite3Dialect) supportReturning() bool {
+	return true
+}
+
+type postgresDialect struct {
+	standardSQLDialect
+}
+
+// placeholder PostgreSQL 使用 $1..$n 作为占位符
+func (p postgresDialect) placeholder(idx int) string {
+	return "$" + strconv.Itoa(idx)
+}
+
+func (p postgresDialect) supportReturning() bool {
+	return true
+}
+
+// insertIds PostgreSQL 不支持 LastInsertId，自增主键通过 RETURNING 回填
+func (p postgresDialect) insertIds(lastId int64, rows int, upsert bool) ([]int64, bool) {
+	return nil, false
+}
+
+var (
+	mysqlKeyRegexp        = regexp.MustCompile(`for key '([^']*)'`)
+	mysqlColumnRegexp     = regexp.MustCompile(`^(?:Column|Field) '([^']*)'`)
+	mysqlForeignKeyRegexp = regexp.MustCompile("CONSTRAINT `([^`]*)`")
+	mysqlCheckRegexp      = regexp.MustCompile(`^Check constraint '([^']*)'`)
+)
+
+// mysqlDriverPkg go-sql-driver/mysql 的包路径，只识别这个包里面的 MySQLError
+const mysqlDriverPkg = "github.com/go-sql-driver/mysql"
+
+// translateErr 根据 MySQLError 的错误码翻译
+func (m mysqlDialect) translateErr(err error) error {
+	val, de, ok := driverErr(err, mysqlDriverPkg, "MySQLError")
+	if !ok {
+		return err
+	}
+
+	code, _ := driverErrCode(de, mysqlDriverPkg, "MySQLError", "Number")
+	msg := driverErrString(val, "Message")
+
+	switch code {
+	case 1062:
+		// MySQL 8.0 的索引名带有表名前缀，例如 'user.idx_email'
+		key := submatch(mysqlKeyRegexp, msg)
+		key = key[strings.LastIndexByte(key, '.')+1:]
+		return &ConstraintError{Kind: ErrDuplicateKey, Constraint: key, Err: err}
+	case 1451, 1452:
+		return &ConstraintError{Kind: ErrForeignKeyViolation, Constraint: submatch(mysqlForeignKeyRegexp, msg), Err: err}
+	case 1048, 1364:
+		return &ConstraintError{Kind: ErrNotNullViolation, Column: submatch(mysqlColumnRegexp, msg), Err: err}
+	case 3819:
+		return &ConstraintError{Kind: ErrCheckViolation, Constraint: submatch(mysqlCheckRegexp, msg), Err: err}
+	case 1213:
+		return &ConstraintError{Kind: ErrDeadlock, Err: err}
+	default:
+		return err
+	}
+}
+
+// translateErr 标准 SQL 没有统一的驱动错误，原样返回
+func (s standardSQLDialect) translateErr(err error) error {
+	return err
+}
+
+// translateErr 根据 go-sqlite3 的扩展错误码翻译，列名和约束名从错误信息中解析，
+// 例如 UNIQUE constraint failed: user.email
+func (s sqlite3Dialect) translateErr(err error) error {
+	_, de, ok := driverErr(err, "go-sqlite3", "Error")
+	if !ok {
+		return err
+	}
+
+	code, _ := driverErrCode(de, "go-sqlite3", "Error", "ExtendedCode")
+	msg := de.Error()
+	detail := ""
+	if idx := strings.Index(msg, ": "); idx >= 0 {
+		detail = msg[idx+2:]
+	}
+
+	switch code {
+	// SQLITE_CONSTRAINT_UNIQUE、SQLITE_CONSTRAINT_PRIMARYKEY
+	case 2067, 1555:
+		return &ConstraintError{Kind: ErrDuplicateKey, Column: sqlite3Columns(detail), Err: err}
+	// SQLITE_CONSTRAINT_FOREIGNKEY
+	case 787:
+		return &ConstraintError{Kind: ErrForeignKeyViolation, Err: err}
+	// SQLITE_CONSTRAINT_NOTNULL
+	case 1299:
+		return &ConstraintError{Kind: ErrNotNullViolation, Column: sqlite3Columns(detail), Err: err}
+	// SQLITE_CONSTRAINT_CHECK，没有命名的约束是表达式
+	case 275:
+		return &ConstraintError{Kind: ErrCheckViolation, Constraint: detail, Err: err}
+	default:
+		return err
+	}
+}
+
+// sqlite3Columns 把 user.first_name, user.last_name 转换成 first_name,last_name
+func sqlite3Columns(detail string) string {
+	if detail == "" {
+		return ""
+	}
+	cols := strings.Split(detail, ", ")
+	for i, col := range cols {
+		cols[i] = col[strings.LastIndexByte(col, '.')+1:]
+	}
+	return strings.Join(cols, ",")
+}
+
+// postgresErr 从 pgx 的 PgError 或者 lib/pq 的 Error 中读取 SQLSTATE、约束名和列名
+func postgresErr(err error) (code, constraint, column string, ok bool) {
+	if val, _, ok := driverErr(err, "", "PgError"); ok {
+		return driverErrString(val, "Code"), driverErrString(val, "ConstraintName"), driverErrString(val, "ColumnName"), true
+	}
+	if val, _, ok := driverErr(err, "lib/pq", "Error"); ok {
+		return driverErrString(val, "Code"), driverErrString(val, "Constraint"), driverErrString(val, "Column"), true
+	}
+	return "", "", "", false
+}
+
+// translateErr 根据 SQLSTATE 翻译，支持 pgx 的 PgError 和 lib/pq 的 Error
+func (p postgresDialect) translateErr(err error) error {
+	code, constraint, column, ok := postgresErr(err)
+	if !ok {
+		return err
+	}
+
+	var kind error
+	switch code {
+	case "23505":
+		kind = ErrDuplicateKey
+	case "23503":
+		kind = ErrForeignKeyViolation
+	case "23502":
+		kind = ErrNotNullViolation
+	case "23514":
+		kind = ErrCheckViolation
+	case "40P01":
+		kind = ErrDeadlock
+	case "40001":
+		kind = ErrSerializationFailure
+	default:
+		return err
+	}
+
+	return &ConstraintError{Kind: kind, Constraint: constraint, Column: column, Err: err}
+}
+
+// submatch 返回第一个分组匹配到的内容
+func submatch(re *regexp.Regexp, s string) string {
+	m := re.FindStringSubmatch(s)
+	if len(m) < 2 {
+		return ""
+	}
+	return m[1]
+}
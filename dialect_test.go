@@ -0,0 +1,150 @@
+package orm
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzziahlin/orm/internal/errs"
+	"testing"
+)
+
+func TestPostgresDialect_Build(t *testing.T) {
+
+	db := memoryDB(t, DBWithDialect(Postgres))
+
+	testCases := []struct {
+		name     string
+		builder  SQLBuilder
+		wantStat *Stat
+		wantErr  error
+	}{
+		{
+			name: "select where",
+			builder: NewSelector[TestModel](db).
+				Where(C("Name").EQ("Jack").AND(C("Age").In(18, 19)).OR(C("Age").Between(30, 40))),
+			wantStat: &Stat{
+				Sql:  `SELECT * FROM "test_model" WHERE (("name" =  $1 ) AND ("age" IN ($2,$3))) OR ("age" BETWEEN  $4  AND  $5 )`,
+				Args: []any{"Jack", 18, 19, 30, 40},
+			},
+		},
+		{
+			name: "select subquery",
+			builder: func() SQLBuilder {
+				sub := NewSelector[OrderDetail](db).Select(C("OrderId")).
+					Where(C("ItemId").EQ("sku")).AsSubQuery("sub")
+				return NewSelector[Order](db).Where(C("UsingCol1").EQ("a").AND(C("Id").InQuery(sub)).AND(C("UsingCol2").EQ("b")))
+			}(),
+			wantStat: &Stat{
+				Sql:  `SELECT * FROM "order" WHERE (("using_col_1" =  $1 ) AND ("id" IN (SELECT "order_id" FROM "order_detail" WHERE "item_id" =  $2 ))) AND ("using_col_2" =  $3 )`,
+				Args: []any{"a", "sku", "b"},
+			},
+		},
+		{
+			name:    "raw",
+			builder: NewSelector[TestModel](db).Where(C("Name").EQ("Jack").AND(Raw(`"age" > ? AND "age" < ?`, 18, 30).AsPredicate())),
+			wantStat: &Stat{
+				Sql:  `SELECT * FROM "test_model" WHERE ("name" =  $1 ) AND ("age" > $2 AND "age" < $3)`,
+				Args: []any{"Jack", 18, 30},
+			},
+		},
+		{
+			name:    "insert",
+			builder: NewInserter[TestModel](db).Values(&TestModel{Name: "Jack", Age: 18}, &TestModel{Name: "Tom", Age: 19}),
+			wantStat: &Stat{
+				Sql:  `INSERT INTO "test_model"("name","age","test_field") VALUES ($1,$2,$3),($4,$5,$6)`,
+				Args: []any{"Jack", 18, "", "Tom", 19, ""},
+			},
+		},
+		{
+			name:    "insert returning generated key",
+			builder: NewInserter[AutoIncrementModel](db).Values(&AutoIncrementModel{Name: "Jack"}),
+			wantStat: &Stat{
+				Sql:  `INSERT INTO "auto_increment_model"("name") VALUES ($1) RETURNING "id"`,
+				Args: []any{"Jack"},
+			},
+		},
+		{
+			name:    "insert returning",
+			builder: NewInserter[TestModel](db).Columns("Name").Values(&TestModel{Name: "Jack"}).Returning("Age", "TestField"),
+			wantStat: &Stat{
+				Sql:  `INSERT INTO "test_model"("name") VALUES ($1) RETURNING "age","test_field"`,
+				Args: []any{"Jack"},
+			},
+		},
+		{
+			name: "upsert",
+			builder: NewInserter[AutoIncrementModel](db).Values(&AutoIncrementModel{Id: 1, Name: "Jack"}).
+				OnDuplicateKey().Update(C("Name"), Assign("Id", Raw(`"id" + ?`, 1))),
+			wantStat: &Stat{
+				Sql:  `INSERT INTO "auto_increment_model"("id","name") VALUES ($1,$2) ON CONFLICT("id") DO UPDATE SET "name"=EXCLUDED."name","id"="id" + $3`,
+				Args: []any{int64(1), "Jack", 1},
+			},
+		},
+		{
+			name:    "update",
+			builder: NewUpdater[TestModel](db).Set(Assign("Age", 19)).Where(C("Name").EQ("Jack")),
+			wantStat: &Stat{
+				Sql:  `UPDATE "test_model" SET "age"= $1  WHERE "name" =  $2 `,
+				Args: []any{19, "Jack"},
+			},
+		},
+		{
+			name:    "delete",
+			builder: NewDeleter[TestModel](db).Where(C("Name").EQ("Jack").OR(C("Age").LT(18))),
+			wantStat: &Stat{
+				Sql:  `DELETE FROM "test_model" WHERE ("name" =  $1 ) OR ("age" <  $2 )`,
+				Args: []any{"Jack", 18},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stat, err := tc.builder.Build()
+
+			assert.Equal(t, tc.wantErr, err)
+
+			if err != nil {
+				return
+			}
+
+			assert.Equal(t, tc.wantStat, stat)
+		})
+	}
+}
+
+func TestInserter_Returning(t *testing.T) {
+
+	t.Run("unsupported", func(t *testing.T) {
+		db := memoryDB(t, DBWithDialect(MySQL))
+		_, err := NewInserter[TestModel](db).Values(&TestModel{}).Returning("Age").Build()
+		assert.Equal(t, errs.ErrUnsupportedReturning, err)
+	})
+
+	t.Run("fill generated keys", func(t *testing.T) {
+		mockDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = mockDB.Close() }()
+
+		mock.ExpectQuery(`INSERT INTO "auto_increment_model"\("name"\) VALUES \(\$1\),\(\$2\) RETURNING "id"`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7).AddRow(8))
+
+		db, err := OpenDB(mockDB, DBWithDialect(Postgres))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vals := []*AutoIncrementModel{{Name: "Jack"}, {Name: "Tom"}}
+		res, err := NewInserter[AutoIncrementModel](db).Values(vals...).Exec(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		affected, err := res.RowsAffected()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), affected)
+		assert.Equal(t, []*AutoIncrementModel{{Id: 7, Name: "Jack"}, {Id: 8, Name: "Tom"}}, vals)
+	})
+}
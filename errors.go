@@ -0,0 +1,119 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/uzziahlin/orm/internal/errs"
+	"time"
+)
+
+// ErrEmptyResult Get 没有查询到数据
+var ErrEmptyResult = errs.ErrEmptyResult
+
+// 方言把驱动返回的错误翻译成下面的错误，使用 errors.Is 判断，
+// 约束名和列名通过 errors.As 拿到 *ConstraintError 读取
+var (
+	ErrDuplicateKey        = errors.New("orm: 唯一约束冲突")
+	ErrForeignKeyViolation = errors.New("orm: 违反外键约束")
+	ErrDeadlock            = errors.New("orm: 死锁")
+	ErrNotNullViolation    = errors.New("orm: 违反非空约束")
+	ErrCheckViolation      = errors.New("orm: 违反检查约束")
+	// ErrSerializationFailure 可串行化隔离级别下的事务冲突，可以重试
+	ErrSerializationFailure = errors.New("orm: 事务序列化失败")
+)
+
+// ConstraintError 翻译之后的驱动错误，errors.Is 可以和 ErrDuplicateKey 等比较，
+// errors.As 仍然可以拿到原始的驱动错误
+type ConstraintError struct {
+	// Kind ErrDuplicateKey、ErrForeignKeyViolation 等
+	Kind error
+	// Constraint 约束或者索引的名字，驱动没有提供时为空
+	Constraint string
+	// Column 违反约束的列，驱动没有提供时为空，多个列用逗号分隔
+	Column string
+	// Err 驱动返回的错误
+	Err error
+}
+
+func (e *ConstraintError) Error() string {
+	msg := e.Kind.Error()
+	if e.Constraint != "" {
+		msg = fmt.Sprintf("%s, 约束 %s", msg, e.Constraint)
+	}
+	if e.Column != "" {
+		msg = fmt.Sprintf("%s, 列 %s", msg, e.Column)
+	}
+	return fmt.Sprintf("%s: %v", msg, e.Err)
+}
+
+func (e *ConstraintError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// QueryError 语句执行失败时返回，记录失败的语句，使用 errors.Is 和 errors.As 判断原因
+type QueryError struct {
+	// Type 语句类型，取值为 OpSelect、OpInsert 等
+	Type  string
+	Table string
+	// Stat 执行的语句，构造失败时为空。默认不保留参数，需要时使用 DBWithQueryErrorArgs
+	Stat *Stat
+	// Elapsed 从开始执行到失败的时间，包括 middleware
+	Elapsed time.Duration
+	Err     error
+}
+
+func (e *QueryError) Error() string {
+	msg := fmt.Sprintf("orm: %s %s 失败", e.Type, e.Table)
+	if e.Stat != nil {
+		msg = fmt.Sprintf("%s, sql: %s", msg, e.Stat.Sql)
+		if e.Stat.Args != nil {
+			msg = fmt.Sprintf("%s, args: %v", msg, e.Stat.Args)
+		}
+	}
+	return fmt.Sprintf("%s, 耗时 %s: %v", msg, e.Elapsed, e.Err)
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// queryError 把执行失败的原因包装成 *QueryError
+func (s *Builder) queryError(qc *QueryContext, err error, elapsed time.Duration) error {
+	qe := &QueryError{
+		Type:    qc.Type,
+		Elapsed: elapsed,
+		Err:     err,
+	}
+	if qc.Model != nil {
+		qe.Table = qc.Model.TabName
+	}
+	if qc.stat != nil {
+		qe.Stat = &Stat{Sql: qc.stat.Sql}
+		if s.queryErrorArgs {
+			qe.Stat.Args = qc.stat.Args
+		}
+	}
+	return qe
+}
+
+// hookError 把 Before 钩子返回的错误包装成 *QueryError，语句没有执行，Stat 按钩子修改之后的实体构造
+func (s *Builder) hookError(qc *QueryContext, err error) error {
+	_, _ = qc.Query()
+	return s.queryError(qc, err, 0)
+}
+
+// translateErr 所有语句执行的最后一步，把驱动错误交给方言翻译，middleware 看到的是翻译之后的错误
+func (s *Builder) translateErr(next HandleFunc) HandleFunc {
+	return func(ctx context.Context, qc *QueryContext) *QueryResult {
+		res := next(ctx, qc)
+		if res.Err != nil {
+			res.Err = s.dialect.translateErr(res.Err)
+		}
+		return res
+	}
+}
@@ -0,0 +1,378 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// PgError 和 pgx 的 pgconn.PgError 结构一致
+type PgError struct {
+	Code           string
+	Message        string
+	ConstraintName string
+	ColumnName     string
+}
+
+func (p *PgError) Error() string {
+	return fmt.Sprintf("ERROR: %s (SQLSTATE %s)", p.Message, p.Code)
+}
+
+type ErrUser struct {
+	Id    int64 `orm:"auto_increment"`
+	Email string
+	Name  *string
+	Age   int
+}
+
+type ErrOrder struct {
+	Id     int64 `orm:"auto_increment"`
+	UserId int64
+}
+
+func TestSQLite3_TranslateErr(t *testing.T) {
+	db, err := Open("sqlite3", "file:translate_err?mode=memory&cache=shared&_foreign_keys=1")
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+
+	for _, ddl := range []string{
+		`CREATE TABLE "err_user"("id" INTEGER PRIMARY KEY AUTOINCREMENT, "email" TEXT UNIQUE, "name" TEXT NOT NULL,
+			"age" INTEGER, CONSTRAINT "age_positive" CHECK ("age" > 0))`,
+		`CREATE TABLE "err_order"("id" INTEGER PRIMARY KEY AUTOINCREMENT, "user_id" INTEGER REFERENCES "err_user"("id"))`,
+	} {
+		_, err = db.ExecContext(ctx, ddl)
+		require.NoError(t, err)
+	}
+
+	name := "Jack"
+	_, err = NewInserter[ErrUser](db).Values(&ErrUser{Email: "jack@test.com", Name: &name, Age: 18}).Exec(ctx)
+	require.NoError(t, err)
+
+	// middleware 看到的是翻译之后的错误
+	var seen error
+	record := func(next HandleFunc) HandleFunc {
+		return func(ctx context.Context, qc *QueryContext) *QueryResult {
+			res := next(ctx, qc)
+			seen = res.Err
+			return res
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		exec     func() error
+		wantKind error
+		wantErr  *ConstraintError
+	}{
+		{
+			name: "duplicate key",
+			exec: func() error {
+				_, err := NewInserter[ErrUser](db).Values(&ErrUser{Email: "jack@test.com", Name: &name, Age: 18}).
+					Use(record).Exec(ctx)
+				return err
+			},
+			wantErr: &ConstraintError{Kind: ErrDuplicateKey, Column: "email"},
+		},
+		{
+			name: "duplicate primary key",
+			exec: func() error {
+				_, err := NewInserter[ErrUser](db).Values(&ErrUser{Id: 1, Email: "tom@test.com", Name: &name, Age: 18}).
+					Use(record).Exec(ctx)
+				return err
+			},
+			wantErr: &ConstraintError{Kind: ErrDuplicateKey, Column: "id"},
+		},
+		{
+			name: "not null",
+			exec: func() error {
+				_, err := NewInserter[ErrUser](db).Values(&ErrUser{Email: "tom@test.com", Age: 18}).Use(record).Exec(ctx)
+				return err
+			},
+			wantErr: &ConstraintError{Kind: ErrNotNullViolation, Column: "name"},
+		},
+		{
+			name: "check",
+			exec: func() error {
+				_, err := NewUpdater[ErrUser](db).Set(Assign("Age", -1)).Where(C("Id").EQ(1)).Use(record).Exec(ctx)
+				return err
+			},
+			wantErr: &ConstraintError{Kind: ErrCheckViolation, Constraint: "age_positive"},
+		},
+		{
+			name: "foreign key",
+			exec: func() error {
+				_, err := NewInserter[ErrOrder](db).Values(&ErrOrder{UserId: 100}).Use(record).Exec(ctx)
+				return err
+			},
+			wantErr: &ConstraintError{Kind: ErrForeignKeyViolation},
+		},
+		{
+			name: "raw query",
+			exec: func() error {
+				_, err := RawQuery[ErrUser](db, `DELETE FROM "err_user" WHERE "id" = ?`, 1).Use(record).Exec(ctx)
+				return err
+			},
+			wantErr: &ConstraintError{Kind: ErrForeignKeyViolation},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.name == "raw query" {
+				_, err := NewInserter[ErrOrder](db).Values(&ErrOrder{UserId: 1}).Exec(ctx)
+				require.NoError(t, err)
+			}
+
+			seen = nil
+			err := tc.exec()
+
+			assert.ErrorIs(t, err, tc.wantErr.Kind)
+			assert.ErrorIs(t, err, seen)
+
+			var ce *ConstraintError
+			require.True(t, errors.As(err, &ce))
+			assert.Equal(t, tc.wantErr.Constraint, ce.Constraint)
+			assert.Equal(t, tc.wantErr.Column, ce.Column)
+
+			// 仍然可以拿到驱动的错误
+			var sqliteErr sqlite3.Error
+			assert.True(t, errors.As(err, &sqliteErr))
+			assert.Equal(t, sqlite3.ErrConstraint, sqliteErr.Code)
+		})
+	}
+}
+
+func TestDialect_TranslateErr(t *testing.T) {
+	testCases := []struct {
+		name    string
+		dialect Dialect
+		err     error
+		wantErr error
+	}{
+		{
+			name:    "mysql duplicate key",
+			dialect: MySQL,
+			err:     &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'jack@test.com' for key 'user.idx_email'"},
+			wantErr: &ConstraintError{Kind: ErrDuplicateKey, Constraint: "idx_email"},
+		},
+		{
+			name:    "mysql 5.7 duplicate key",
+			dialect: MySQL,
+			err:     &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"},
+			wantErr: &ConstraintError{Kind: ErrDuplicateKey, Constraint: "PRIMARY"},
+		},
+		{
+			name:    "mysql foreign key",
+			dialect: MySQL,
+			err: &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails " +
+				"(`test`.`order`, CONSTRAINT `fk_order_user` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`))"},
+			wantErr: &ConstraintError{Kind: ErrForeignKeyViolation, Constraint: "fk_order_user"},
+		},
+		{
+			name:    "mysql not null",
+			dialect: MySQL,
+			err:     &mysql.MySQLError{Number: 1048, Message: "Column 'name' cannot be null"},
+			wantErr: &ConstraintError{Kind: ErrNotNullViolation, Column: "name"},
+		},
+		{
+			name:    "mysql no default value",
+			dialect: MySQL,
+			err:     &mysql.MySQLError{Number: 1364, Message: "Field 'name' doesn't have a default value"},
+			wantErr: &ConstraintError{Kind: ErrNotNullViolation, Column: "name"},
+		},
+		{
+			name:    "mysql check",
+			dialect: MySQL,
+			err:     &mysql.MySQLError{Number: 3819, Message: "Check constraint 'age_positive' is violated."},
+			wantErr: &ConstraintError{Kind: ErrCheckViolation, Constraint: "age_positive"},
+		},
+		{
+			name:    "mysql deadlock",
+			dialect: MySQL,
+			err:     &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"},
+			wantErr: &ConstraintError{Kind: ErrDeadlock},
+		},
+		{
+			name:    "mysql other",
+			dialect: MySQL,
+			err:     &mysql.MySQLError{Number: 1146, Message: "Table 'test.user' doesn't exist"},
+		},
+		{
+			name:    "postgres duplicate key",
+			dialect: Postgres,
+			err:     &PgError{Code: "23505", ConstraintName: "user_email_key"},
+			wantErr: &ConstraintError{Kind: ErrDuplicateKey, Constraint: "user_email_key"},
+		},
+		{
+			name:    "postgres not null",
+			dialect: Postgres,
+			err:     &PgError{Code: "23502", ColumnName: "name"},
+			wantErr: &ConstraintError{Kind: ErrNotNullViolation, Column: "name"},
+		},
+		{
+			name:    "postgres deadlock",
+			dialect: Postgres,
+			err:     &PgError{Code: "40P01"},
+			wantErr: &ConstraintError{Kind: ErrDeadlock},
+		},
+		{
+			name:    "postgres serialization failure",
+			dialect: Postgres,
+			err:     &PgError{Code: "40001"},
+			wantErr: &ConstraintError{Kind: ErrSerializationFailure},
+		},
+		{
+			// 不在驱动包里面的 MySQLError 不翻译
+			name:    "mysql lookalike",
+			dialect: MySQL,
+			err:     &MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"},
+		},
+		{
+			name:    "postgres other",
+			dialect: Postgres,
+			err:     &PgError{Code: "42P01"},
+		},
+		{
+			name:    "wrapped",
+			dialect: MySQL,
+			err:     fmt.Errorf("insert user: %w", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"}),
+			wantErr: &ConstraintError{Kind: ErrDuplicateKey, Constraint: "PRIMARY"},
+		},
+		{
+			name:    "standard",
+			dialect: Standard,
+			err:     &PgError{Code: "23505"},
+		},
+		{
+			name:    "not driver error",
+			dialect: SQLite3,
+			err:     errors.New("some error"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.dialect.translateErr(tc.err)
+			if tc.wantErr == nil {
+				assert.Equal(t, tc.err, err)
+				return
+			}
+			want := tc.wantErr.(*ConstraintError)
+			want.Err = tc.err
+			assert.Equal(t, want, err)
+			assert.ErrorIs(t, err, want.Kind)
+		})
+	}
+}
+
+func TestConstraintError_Error(t *testing.T) {
+	err := &ConstraintError{
+		Kind:       ErrDuplicateKey,
+		Constraint: "idx_email",
+		Err:        &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"},
+	}
+	assert.Equal(t, "orm: 唯一约束冲突, 约束 idx_email: Error 1062: Duplicate entry", err.Error())
+
+	// 翻译之后的死锁仍然可以重试
+	assert.True(t, DefaultRetryable(Postgres.translateErr(&PgError{Code: "40P01"})))
+	assert.False(t, DefaultRetryable(err))
+}
+
+func TestQueryError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     []DBOption
+		mock     func(mock sqlmock.Sqlmock)
+		exec     func(db *DB) error
+		wantErr  error
+		wantType string
+		wantStat *Stat
+		wantMsg  string
+	}{
+		{
+			name: "exec error",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("DELETE .*").WillReturnError(errors.New("exec error"))
+			},
+			exec: func(db *DB) error {
+				_, err := NewDeleter[TestModel](db).Where(C("Name").EQ("Jack")).Exec(context.Background())
+				return err
+			},
+			wantType: OpDelete,
+			wantStat: &Stat{Sql: "DELETE FROM `test_model` WHERE `name` =  ? "},
+			wantMsg:  "orm: DELETE test_model 失败, sql: DELETE FROM `test_model` WHERE `name` =  ? ",
+		},
+		{
+			name: "with args",
+			opts: []DBOption{DBWithQueryErrorArgs()},
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("DELETE .*").WillReturnError(errors.New("exec error"))
+			},
+			exec: func(db *DB) error {
+				_, err := NewDeleter[TestModel](db).Where(C("Name").EQ("Jack")).Exec(context.Background())
+				return err
+			},
+			wantType: OpDelete,
+			wantStat: &Stat{Sql: "DELETE FROM `test_model` WHERE `name` =  ? ", Args: []any{"Jack"}},
+			wantMsg:  "orm: DELETE test_model 失败, sql: DELETE FROM `test_model` WHERE `name` =  ? , args: [Jack]",
+		},
+		{
+			name: "no rows",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"name"}))
+			},
+			exec: func(db *DB) error {
+				_, err := NewSelector[TestModel](db).Get(context.Background())
+				return err
+			},
+			wantErr:  ErrEmptyResult,
+			wantType: OpSelect,
+			wantStat: &Stat{Sql: "SELECT * FROM `test_model` LIMIT 1"},
+			wantMsg:  "orm: SELECT test_model 失败, sql: SELECT * FROM `test_model` LIMIT 1, 耗时 ",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer func() { _ = mockDB.Close() }()
+
+			db, err := OpenDB(mockDB, tc.opts...)
+			require.NoError(t, err)
+
+			tc.mock(mock)
+			err = tc.exec(db)
+
+			var qe *QueryError
+			require.True(t, errors.As(err, &qe))
+			assert.Equal(t, tc.wantType, qe.Type)
+			assert.Equal(t, "test_model", qe.Table)
+			assert.Equal(t, tc.wantStat, qe.Stat)
+			assert.Greater(t, qe.Elapsed, time.Duration(0))
+			assert.Contains(t, err.Error(), tc.wantMsg)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// queryErrCause 取出 QueryError 包装的原因，其它错误原样返回
+func queryErrCause(err error) error {
+	var qe *QueryError
+	if errors.As(err, &qe) {
+		return qe.Err
+	}
+	return err
+}
@@ -0,0 +1,289 @@
+package orm
+
+import (
+	"context"
+	"github.com/uzziahlin/orm/internal/errs"
+	"github.com/uzziahlin/orm/model"
+	"reflect"
+	"time"
+)
+
+// execute 所有终结方法统一的执行路径，QueryContext 依次经过 middleware 之后交给 handler
+// Use 设置的 middleware 包在 DBWithMiddlewares 设置的外面，同一层里后面的在外层，先执行
+// 执行失败时返回 *QueryError，middleware 看到的是没有包装的错误。
+// 结束时执行 QueryContext.Defer 注册的方法，Iterate 成功时推迟到 Rows.Close
+func (s *Builder) execute(ctx context.Context, qc *QueryContext, handler HandleFunc) *QueryResult {
+	if tx, ok := s.session(ctx).(*Tx); ok {
+		qc.tx = tx
+	}
+
+	root := s.translateErr(handler)
+
+	for _, md := range s.core.mdls {
+		root = md(root)
+	}
+
+	for _, md := range s.mdls {
+		root = md(root)
+	}
+
+	start := time.Now()
+	res := root(ctx, qc)
+	if res.Err != nil {
+		res.Err = s.queryError(qc, res.Err, time.Since(start))
+	}
+
+	if !qc.stream || res.Err != nil {
+		qc.release()
+	}
+
+	return res
+}
+
+// exec 执行 INSERT、UPDATE、DELETE 这类不返回行的语句
+func (s *Builder) exec(ctx context.Context, qc *QueryContext) (Result, error) {
+	res := s.execute(ctx, qc, s.execHandler())
+
+	if res.Err != nil {
+		return nil, res.Err
+	}
+
+	return res.Result.(Result), nil
+}
+
+func (s *Builder) execHandler() HandleFunc {
+	return func(ctx context.Context, qc *QueryContext) *QueryResult {
+		stat, err := qc.Query()
+
+		if err != nil {
+			return &QueryResult{
+				Result: nil,
+				Err:    err,
+			}
+		}
+
+		res, err := s.session(ctx).ExecContext(ctx, stat.Sql, stat.Args...)
+
+		return &QueryResult{
+			Result: res,
+			Err:    err,
+		}
+	}
+}
+
+// get 执行查询并把第一行映射成 T，没有数据时返回 ErrEmptyResult
+func get[T any](ctx context.Context, s *Builder, qc *QueryContext) (*T, error) {
+	qc.resultType = reflect.TypeOf((*T)(nil))
+	res := s.execute(ctx, qc, getHandler[T](s))
+
+	if res.Err != nil {
+		return nil, res.Err
+	}
+
+	return res.Result.(*T), nil
+}
+
+func getHandler[T any](s *Builder) HandleFunc {
+	return func(ctx context.Context, qc *QueryContext) *QueryResult {
+		stat, err := qc.Query()
+
+		if err != nil {
+			return &QueryResult{
+				Result: nil,
+				Err:    err,
+			}
+		}
+
+		rows, err := s.session(ctx).QueryContext(ctx, stat.Sql, stat.Args...)
+
+		if err != nil {
+			return &QueryResult{
+				Result: nil,
+				Err:    err,
+			}
+		}
+
+		defer func() {
+			_ = rows.Close()
+		}()
+
+		if !rows.Next() {
+			err = rows.Err()
+			if err == nil {
+				err = errs.NewErrEmptyResult()
+			}
+			return &QueryResult{
+				Result: nil,
+				Err:    err,
+			}
+		}
+
+		tp := new(T)
+		meta, err := s.registry.Get(tp)
+		if err != nil {
+			return &QueryResult{
+				Result: nil,
+				Err:    err,
+			}
+		}
+
+		val := s.creator(tp, meta)
+		err = val.SetColumns(rows)
+
+		if err == nil && meta.Hooks.Has(model.HookAfterFind) {
+			err = any(tp).(AfterFindHook).AfterFind(ctx)
+		}
+
+		if err != nil {
+			return &QueryResult{
+				Result: nil,
+				Err:    err,
+			}
+		}
+
+		return &QueryResult{
+			Result: tp,
+			Err:    nil,
+		}
+	}
+}
+
+// getMulti 执行查询并把每一行映射成 T
+func getMulti[T any](ctx context.Context, s *Builder, qc *QueryContext) ([]*T, error) {
+	qc.resultType = reflect.TypeOf([]*T(nil))
+	res := s.execute(ctx, qc, getMultiHandler[T](s))
+
+	if res.Err != nil {
+		return nil, res.Err
+	}
+
+	return res.Result.([]*T), nil
+}
+
+func getMultiHandler[T any](s *Builder) HandleFunc {
+	return func(ctx context.Context, qc *QueryContext) *QueryResult {
+		stat, err := qc.Query()
+
+		if err != nil {
+			return &QueryResult{
+				Result: nil,
+				Err:    err,
+			}
+		}
+
+		rows, err := s.session(ctx).QueryContext(ctx, stat.Sql, stat.Args...)
+
+		if err != nil {
+			return &QueryResult{
+				Result: nil,
+				Err:    err,
+			}
+		}
+
+		defer func() {
+			_ = rows.Close()
+		}()
+
+		meta, err := s.registry.Get(new(T))
+
+		if err != nil {
+			return &QueryResult{
+				Result: nil,
+				Err:    err,
+			}
+		}
+
+		res := make([]*T, 0)
+		afterFind := meta.Hooks.Has(model.HookAfterFind)
+
+		for rows.Next() {
+			tp := new(T)
+
+			err = s.creator(tp, meta).SetColumns(rows)
+
+			if err == nil && afterFind {
+				err = any(tp).(AfterFindHook).AfterFind(ctx)
+			}
+
+			if err != nil {
+				return &QueryResult{
+					Result: nil,
+					Err:    err,
+				}
+			}
+
+			res = append(res, tp)
+		}
+
+		if err = rows.Err(); err != nil {
+			return &QueryResult{
+				Result: nil,
+				Err:    err,
+			}
+		}
+
+		return &QueryResult{
+			Result: res,
+			Err:    nil,
+		}
+	}
+}
+
+// iterate 执行查询但不读取结果，返回的 Rows 由调用方逐行映射并负责关闭
+func iterate[T any](ctx context.Context, s *Builder, qc *QueryContext) (*Rows[T], error) {
+	qc.resultType = reflect.TypeOf((*Rows[T])(nil))
+	// 结果还没有读取，不能缓存也不能共享
+	qc.cacheTTL, qc.singleflight = 0, false
+	qc.stream = true
+	res := s.execute(ctx, qc, iterateHandler[T](s))
+
+	if res.Err != nil {
+		return nil, res.Err
+	}
+
+	return res.Result.(*Rows[T]), nil
+}
+
+func iterateHandler[T any](s *Builder) HandleFunc {
+	return func(ctx context.Context, qc *QueryContext) *QueryResult {
+		stat, err := qc.Query()
+
+		if err != nil {
+			return &QueryResult{
+				Result: nil,
+				Err:    err,
+			}
+		}
+
+		meta, err := s.registry.Get(new(T))
+
+		if err != nil {
+			return &QueryResult{
+				Result: nil,
+				Err:    err,
+			}
+		}
+
+		start := time.Now()
+		rows, err := s.session(ctx).QueryContext(ctx, stat.Sql, stat.Args...)
+
+		if err != nil {
+			return &QueryResult{
+				Result: nil,
+				Err:    err,
+			}
+		}
+
+		return &QueryResult{
+			Result: &Rows[T]{
+				ctx:   ctx,
+				rows:  rows,
+				s:     s,
+				qc:    qc,
+				meta:  meta,
+				start: start,
+			},
+			Err: nil,
+		}
+	}
+}
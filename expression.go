@@ -1,5 +1,7 @@
 package orm
 
+import "reflect"
+
 type Expression interface {
 	expr()
 }
@@ -27,3 +29,34 @@ func Raw(expr string, args ...any) RawExpr {
 		args: args,
 	}
 }
+
+// valueList IN 和 NOT IN 右边的值列表
+type valueList struct {
+	vals []any
+}
+
+func (v valueList) expr() {}
+
+// valuesOf 构造值列表，只传入一个切片时把切片展开
+// In(1, 2, 3) 和 In([]int{1, 2, 3}) 是等价的
+func valuesOf(vals []any) valueList {
+	if len(vals) == 1 {
+		val := reflect.ValueOf(vals[0])
+		if val.Kind() == reflect.Slice && val.Type().Elem().Kind() != reflect.Uint8 {
+			res := make([]any, 0, val.Len())
+			for i := 0; i < val.Len(); i++ {
+				res = append(res, val.Index(i).Interface())
+			}
+			return valueList{vals: res}
+		}
+	}
+	return valueList{vals: vals}
+}
+
+// betweenRange BETWEEN 右边的区间
+type betweenRange struct {
+	low  Expression
+	high Expression
+}
+
+func (b betweenRange) expr() {}
@@ -0,0 +1,58 @@
+package orm
+
+import (
+	"fmt"
+	"github.com/uzziahlin/orm/model"
+)
+
+// FullTableError 语句会作用于整张表：没有 WHERE 的 UPDATE、DELETE，或者大表上没有 LIMIT 的 SELECT。
+// Get 没有设置 Limit 时会加上 LIMIT 1，不会触发
+type FullTableError struct {
+	// Type 语句类型，取值为 OpSelect、OpUpdate、OpDelete
+	Type  string
+	Table string
+	// Stat 被拒绝的语句
+	Stat *Stat
+}
+
+func (e *FullTableError) Error() string {
+	return fmt.Sprintf("orm: %s 作用于整张表 %s，确实需要请调用 AllowFullTable: %s", e.Type, e.Table, e.Stat.Sql)
+}
+
+// fullTableChecker 可能作用于整张表的语句
+type fullTableChecker interface {
+	// fullTable 语句是否作用于整张表，调用过 AllowFullTable 时返回 false
+	fullTable(meta *model.Model) bool
+}
+
+// CheckFullTable 语句作用于整张表时返回 *FullTableError，用于实现全表保护的 middleware
+func (qc *QueryContext) CheckFullTable() error {
+	checker, ok := qc.builder.(fullTableChecker)
+	if !ok || qc.Model == nil || !checker.fullTable(qc.Model) {
+		return nil
+	}
+
+	stat, err := qc.Query()
+	if err != nil {
+		return err
+	}
+
+	return &FullTableError{
+		Type:  qc.Type,
+		Table: qc.Model.TabName,
+		Stat:  stat,
+	}
+}
+
+// checkFullTable 开启 DBWithFullTableGuard 时拒绝作用于整张表的语句，子查询由最外层的语句决定
+func (b *Builder) checkFullTable(typ string, checker fullTableChecker, stat *Stat) error {
+	if !b.fullTableGuard || b.nested || !checker.fullTable(b.meta) {
+		return nil
+	}
+
+	return &FullTableError{
+		Type:  typ,
+		Table: b.meta.TabName,
+		Stat:  stat,
+	}
+}
@@ -0,0 +1,154 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uzziahlin/orm/model"
+	"testing"
+)
+
+func TestDBWithFullTableGuard(t *testing.T) {
+	reg := model.NewRegistry()
+	_, err := reg.Register(&Order{}, model.ModelWithLargeTable())
+	require.NoError(t, err)
+
+	db := memoryDB(t, DBWithDialect(MySQL), DBWithRegistry(reg), DBWithFullTableGuard())
+
+	testCases := []struct {
+		name     string
+		builder  SQLBuilder
+		wantStat *Stat
+		wantErr  error
+	}{
+		{
+			name:    "update without where",
+			builder: NewUpdater[TestModel](db).Set(Assign("Age", 18)),
+			wantErr: &FullTableError{
+				Type:  OpUpdate,
+				Table: "test_model",
+				Stat:  &Stat{Sql: "UPDATE `test_model` SET `age`= ? ", Args: []any{18}},
+			},
+		},
+		{
+			name:     "update with where",
+			builder:  NewUpdater[TestModel](db).Set(Assign("Age", 18)).Where(C("Name").EQ("Jack")),
+			wantStat: &Stat{Sql: "UPDATE `test_model` SET `age`= ?  WHERE `name` =  ? ", Args: []any{18, "Jack"}},
+		},
+		{
+			name:     "update allow full table",
+			builder:  NewUpdater[TestModel](db).Set(Assign("Age", 18)).AllowFullTable(),
+			wantStat: &Stat{Sql: "UPDATE `test_model` SET `age`= ? ", Args: []any{18}},
+		},
+		{
+			name:    "delete without where",
+			builder: NewDeleter[TestModel](db),
+			wantErr: &FullTableError{
+				Type:  OpDelete,
+				Table: "test_model",
+				Stat:  &Stat{Sql: "DELETE FROM `test_model`"},
+			},
+		},
+		{
+			name:     "delete allow full table",
+			builder:  NewDeleter[TestModel](db).AllowFullTable(),
+			wantStat: &Stat{Sql: "DELETE FROM `test_model`"},
+		},
+		{
+			name:     "select small table without limit",
+			builder:  NewSelector[TestModel](db),
+			wantStat: &Stat{Sql: "SELECT * FROM `test_model`"},
+		},
+		{
+			// 大表即使有 WHERE 也要求 LIMIT
+			name:    "select large table without limit",
+			builder: NewSelector[Order](db).Where(C("Id").GT(10)),
+			wantErr: &FullTableError{
+				Type:  OpSelect,
+				Table: "order",
+				Stat:  &Stat{Sql: "SELECT * FROM `order` WHERE `id` >  ? ", Args: []any{10}},
+			},
+		},
+		{
+			name:     "select large table with limit",
+			builder:  NewSelector[Order](db).Limit(10),
+			wantStat: &Stat{Sql: "SELECT * FROM `order` LIMIT 10"},
+		},
+		{
+			// 子查询由外层的 LIMIT 限制，不单独检查
+			name: "select large table in subquery",
+			builder: NewSelector[Order](db).Where(C("Id").InQuery(
+				NewSelector[Order](db).Select(C("Id")).Where(C("UsingCol1").EQ("a")).AsSubQuery("sub"))).Limit(10),
+			wantStat: &Stat{
+				Sql:  "SELECT * FROM `order` WHERE `id` IN (SELECT `id` FROM `order` WHERE `using_col_1` =  ? ) LIMIT 10",
+				Args: []any{"a"},
+			},
+		},
+		{
+			name:     "select large table allow full table",
+			builder:  NewSelector[Order](db).AllowFullTable(),
+			wantStat: &Stat{Sql: "SELECT * FROM `order`"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stat, err := tc.builder.Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantStat, stat)
+		})
+	}
+}
+
+func TestDBWithFullTableGuard_Get(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	reg := model.NewRegistry()
+	_, err = reg.Register(&Order{}, model.ModelWithLargeTable())
+	require.NoError(t, err)
+
+	db, err := OpenDB(mockDB, DBWithRegistry(reg), DBWithFullTableGuard())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	// Get 加上 LIMIT 1，不会读取整张表
+	mock.ExpectQuery("SELECT \\* FROM `order` WHERE `id` = \\? LIMIT 1$").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "using_col_1", "using_col_2"}).AddRow(1, "a", "b"))
+	sel := NewSelector[Order](db).Where(C("Id").EQ(1))
+	order, err := sel.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &Order{Id: 1, UsingCol1: "a", UsingCol2: "b"}, order)
+
+	// 同一个 Selector 的 GetMulti 仍然受限制
+	_, err = sel.GetMulti(ctx)
+	var fullTableErr *FullTableError
+	assert.True(t, errors.As(err, &fullTableErr))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFullTableError(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	db, err := OpenDB(mockDB, DBWithFullTableGuard())
+	require.NoError(t, err)
+
+	// 语句在构造阶段就被拒绝，不会发到数据库
+	_, err = NewDeleter[TestModel](db).Exec(context.Background())
+
+	var fullTableErr *FullTableError
+	require.True(t, errors.As(err, &fullTableErr))
+	assert.Equal(t, "DELETE FROM `test_model`", fullTableErr.Stat.Sql)
+	assert.Equal(t, "orm: DELETE 作用于整张表 test_model，确实需要请调用 AllowFullTable: DELETE FROM `test_model`", fullTableErr.Error())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,94 @@
+package orm
+
+import (
+	"context"
+	"github.com/uzziahlin/orm/model"
+	"reflect"
+	"sync"
+)
+
+// 实体可以选择实现下面的钩子，接收者需要是指针。
+// sess 是执行语句使用的 Session，在事务中执行时是这个事务，可以在钩子里面继续执行其他语句。
+// Before 钩子返回 error 时不会执行语句。钩子返回的 error 都包装在 *QueryError 里返回
+
+// BeforeInsertHook Inserter 执行之前在每个要插入的实体上调用，可以在这里修改实体
+type BeforeInsertHook interface {
+	BeforeInsert(ctx context.Context, sess Session) error
+}
+
+// AfterInsertHook Inserter 执行成功之后在每个插入的实体上调用，自增主键已经回填
+type AfterInsertHook interface {
+	AfterInsert(ctx context.Context, sess Session) error
+}
+
+// BeforeUpdateHook Updater 执行之前在 Update 指定的实体上调用，没有指定实体时不调用
+type BeforeUpdateHook interface {
+	BeforeUpdate(ctx context.Context, sess Session) error
+}
+
+// AfterFindHook Selector 和 RawQuerier 把每一行映射到实体之后调用
+type AfterFindHook interface {
+	AfterFind(ctx context.Context) error
+}
+
+// BeforeDeleteHook Deleter 执行之前在 Delete 指定的实体上调用，没有指定实体时不调用
+type BeforeDeleteHook interface {
+	BeforeDelete(ctx context.Context, sess Session) error
+}
+
+// hooks 钩子对应的接口
+var hooks = []struct {
+	hook  model.Hook
+	iface reflect.Type
+}{
+	{hook: model.HookBeforeInsert, iface: reflect.TypeOf((*BeforeInsertHook)(nil)).Elem()},
+	{hook: model.HookAfterInsert, iface: reflect.TypeOf((*AfterInsertHook)(nil)).Elem()},
+	{hook: model.HookBeforeUpdate, iface: reflect.TypeOf((*BeforeUpdateHook)(nil)).Elem()},
+	{hook: model.HookAfterFind, iface: reflect.TypeOf((*AfterFindHook)(nil)).Elem()},
+	{hook: model.HookBeforeDelete, iface: reflect.TypeOf((*BeforeDeleteHook)(nil)).Elem()},
+}
+
+// hookRegistry 模型注册时检测 *T 实现了哪些钩子，结果保存在 Model.Hooks 中，
+// 执行语句时没有实现钩子的模型不需要对每一行做类型断言
+type hookRegistry struct {
+	model.Registry
+	// detected *model.Model 到 *sync.Once，每个模型只检测一次
+	detected sync.Map
+}
+
+func newHookRegistry(reg model.Registry) *hookRegistry {
+	if r, ok := reg.(*hookRegistry); ok {
+		return r
+	}
+	return &hookRegistry{Registry: reg}
+}
+
+func (r *hookRegistry) Register(m any, opts ...model.Option) (*model.Model, error) {
+	meta, err := r.Registry.Register(m, opts...)
+	if err != nil {
+		return nil, err
+	}
+	r.detect(m, meta)
+	return meta, nil
+}
+
+func (r *hookRegistry) Get(m any) (*model.Model, error) {
+	meta, err := r.Registry.Get(m)
+	if err != nil {
+		return nil, err
+	}
+	r.detect(m, meta)
+	return meta, nil
+}
+
+func (r *hookRegistry) detect(m any, meta *model.Model) {
+	once, _ := r.detected.LoadOrStore(meta, &sync.Once{})
+	once.(*sync.Once).Do(func() {
+		typ := reflect.TypeOf(m)
+		for _, h := range hooks {
+			if typ.Implements(h.iface) {
+				meta.Hooks |= h.hook
+			}
+		}
+	})
+}
@@ -0,0 +1,285 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uzziahlin/orm/model"
+	"testing"
+)
+
+// hookCalls 记录 HookModel 钩子的调用，hookErrs 指定钩子返回的错误
+var (
+	hookCalls []string
+	hookErrs  map[string]error
+)
+
+type HookModel struct {
+	Id   int64 `orm:"auto_increment"`
+	Name string
+}
+
+func (m *HookModel) record(hook string, sess Session) error {
+	if sess == nil {
+		hookCalls = append(hookCalls, fmt.Sprintf("%s %d %s", hook, m.Id, m.Name))
+	} else {
+		hookCalls = append(hookCalls, fmt.Sprintf("%s %d %s %T", hook, m.Id, m.Name, sess))
+	}
+	return hookErrs[hook]
+}
+
+func (m *HookModel) BeforeInsert(ctx context.Context, sess Session) error {
+	if m.Name == "" {
+		m.Name = "anonymous"
+	}
+	return m.record("BeforeInsert", sess)
+}
+
+func (m *HookModel) AfterInsert(ctx context.Context, sess Session) error {
+	return m.record("AfterInsert", sess)
+}
+
+func (m *HookModel) BeforeUpdate(ctx context.Context, sess Session) error {
+	return m.record("BeforeUpdate", sess)
+}
+
+func (m *HookModel) AfterFind(ctx context.Context) error {
+	return m.record("AfterFind", nil)
+}
+
+func (m *HookModel) BeforeDelete(ctx context.Context, sess Session) error {
+	return m.record("BeforeDelete", sess)
+}
+
+type AfterFindModel struct {
+	Name string
+}
+
+func (m *AfterFindModel) AfterFind(ctx context.Context) error {
+	return nil
+}
+
+func TestRegistry_Hooks(t *testing.T) {
+	reg := newHookRegistry(model.NewRegistry())
+
+	m, err := reg.Get(&HookModel{})
+	require.NoError(t, err)
+	assert.Equal(t, model.HookBeforeInsert|model.HookAfterInsert|model.HookBeforeUpdate|
+		model.HookAfterFind|model.HookBeforeDelete, m.Hooks)
+
+	m, err = reg.Get(&AfterFindModel{})
+	require.NoError(t, err)
+	assert.Equal(t, model.HookAfterFind, m.Hooks)
+	assert.False(t, m.Hooks.Has(model.HookBeforeInsert))
+
+	m, err = reg.Get(&TestModel{})
+	require.NoError(t, err)
+	assert.Equal(t, model.Hook(0), m.Hooks)
+
+	// 注册时同样检测
+	m, err = reg.Register(&AfterFindModel{}, model.ModelWithLargeTable())
+	require.NoError(t, err)
+	assert.Equal(t, model.HookAfterFind, m.Hooks)
+
+	// model 包自己不检测钩子
+	m, err = model.NewRegistry().Get(&HookModel{})
+	require.NoError(t, err)
+	assert.Equal(t, model.Hook(0), m.Hooks)
+}
+
+func TestHooks_SQLite3(t *testing.T) {
+	db, err := Open("sqlite3", "file:hooks?mode=memory&cache=shared")
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE "hook_model"("id" INTEGER PRIMARY KEY AUTOINCREMENT, "name" TEXT)`)
+	require.NoError(t, err)
+
+	hookCalls, hookErrs = nil, nil
+
+	// BeforeInsert 修改的实体会被插入，AfterInsert 时主键已经回填
+	_, err = NewInserter[HookModel](db).Values(&HookModel{Name: "Jack"}, &HookModel{}, &HookModel{Name: "Ken"}).Exec(ctx)
+	require.NoError(t, err)
+
+	// 事务中钩子拿到的是事务
+	err = db.DoTx(ctx, nil, func(ctx context.Context, tx *Tx) error {
+		if _, err := NewUpdater[HookModel](db).Update(&HookModel{Id: 1, Name: "Tom"}).
+			Set(C("Name")).Where(C("Id").EQ(1)).Exec(ctx); err != nil {
+			return err
+		}
+		_, err := NewDeleter[HookModel](tx).Delete(&HookModel{Id: 3, Name: "Ken"}).Where(C("Id").EQ(3)).Exec(ctx)
+		return err
+	})
+	require.NoError(t, err)
+
+	users, err := NewSelector[HookModel](db).GetMulti(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*HookModel{{Id: 1, Name: "Tom"}, {Id: 2, Name: "anonymous"}}, users)
+
+	_, err = NewSelector[HookModel](db).Where(C("Id").EQ(1)).Get(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"BeforeInsert 0 Jack *orm.DB",
+		"BeforeInsert 0 anonymous *orm.DB",
+		"BeforeInsert 0 Ken *orm.DB",
+		"AfterInsert 1 Jack *orm.DB",
+		"AfterInsert 2 anonymous *orm.DB",
+		"AfterInsert 3 Ken *orm.DB",
+		"BeforeUpdate 1 Tom *orm.Tx",
+		"BeforeDelete 3 Ken *orm.Tx",
+		"AfterFind 1 Tom",
+		"AfterFind 2 anonymous",
+		"AfterFind 1 Tom",
+	}, hookCalls)
+}
+
+func TestHooks_Error(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+
+	hookErr := errors.New("hook error")
+
+	testCases := []struct {
+		name string
+		hook string
+		mock func(mock sqlmock.Sqlmock)
+		exec func(ctx context.Context) error
+		// wantSql QueryError 带上的语句
+		wantSql string
+	}{
+		{
+			name: "before insert",
+			hook: "BeforeInsert",
+			exec: func(ctx context.Context) error {
+				_, err := NewInserter[HookModel](db).Values(&HookModel{Name: "Jack"}).Exec(ctx)
+				return err
+			},
+			wantSql: "INSERT INTO `hook_model`(`name`) VALUES (?)",
+		},
+		{
+			// 语句已经执行，同样带上语句
+			name: "after insert",
+			hook: "AfterInsert",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT .*").WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			exec: func(ctx context.Context) error {
+				_, err := NewInserter[HookModel](db).Values(&HookModel{Name: "Jack"}).Exec(ctx)
+				return err
+			},
+			wantSql: "INSERT INTO `hook_model`(`name`) VALUES (?)",
+		},
+		{
+			name: "before update",
+			hook: "BeforeUpdate",
+			exec: func(ctx context.Context) error {
+				_, err := NewUpdater[HookModel](db).Update(&HookModel{Name: "Tom"}).Set(C("Name")).Exec(ctx)
+				return err
+			},
+			wantSql: "UPDATE `hook_model` SET `name`= ? ",
+		},
+		{
+			name: "before delete",
+			hook: "BeforeDelete",
+			exec: func(ctx context.Context) error {
+				_, err := NewDeleter[HookModel](db).Delete(&HookModel{Id: 1}).Where(C("Id").EQ(1)).Exec(ctx)
+				return err
+			},
+			wantSql: "DELETE FROM `hook_model` WHERE `id` =  ? ",
+		},
+		{
+			name: "after find",
+			hook: "AfterFind",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Jack"))
+			},
+			exec: func(ctx context.Context) error {
+				_, err := NewSelector[HookModel](db).Get(ctx)
+				return err
+			},
+			wantSql: "SELECT * FROM `hook_model` LIMIT 1",
+		},
+		{
+			name: "after find multi",
+			hook: "AfterFind",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Jack"))
+			},
+			exec: func(ctx context.Context) error {
+				_, err := NewSelector[HookModel](db).GetMulti(ctx)
+				return err
+			},
+			wantSql: "SELECT * FROM `hook_model`",
+		},
+		{
+			name: "after find each",
+			hook: "AfterFind",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Jack"))
+			},
+			exec: func(ctx context.Context) error {
+				return NewSelector[HookModel](db).Each(ctx, func(*HookModel) error {
+					return nil
+				})
+			},
+			wantSql: "SELECT * FROM `hook_model`",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hookCalls, hookErrs = nil, map[string]error{tc.hook: hookErr}
+			defer func() { hookErrs = nil }()
+
+			if tc.mock != nil {
+				tc.mock(mock)
+			}
+
+			err := tc.exec(context.Background())
+			assert.ErrorIs(t, err, hookErr)
+			if tc.wantSql != "" {
+				var qe *QueryError
+				require.True(t, errors.As(err, &qe))
+				assert.Equal(t, tc.wantSql, qe.Stat.Sql)
+			}
+			// Before 钩子出错时语句不会执行
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestHooks_WithoutEntity(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+
+	hookCalls = nil
+	hookErrs = map[string]error{"BeforeUpdate": errors.New("hook error"), "BeforeDelete": errors.New("hook error")}
+	defer func() { hookErrs = nil }()
+
+	// 没有指定实体时不调用钩子，语句正常执行
+	ctx := context.Background()
+	mock.ExpectExec("UPDATE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = NewUpdater[HookModel](db).Set(Assign("Name", "Tom")).Where(C("Id").EQ(1)).Exec(ctx)
+	require.NoError(t, err)
+
+	mock.ExpectExec("DELETE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = NewDeleter[HookModel](db).Where(C("Id").EQ(1)).Exec(ctx)
+	require.NoError(t, err)
+
+	assert.Empty(t, hookCalls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
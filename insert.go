@@ -1,8 +1,13 @@
 package orm
 
 import (
+	"context"
 	"errors"
 	"github.com/uzziahlin/orm/internal/errs"
+	"github.com/uzziahlin/orm/model"
+	"reflect"
+	"strings"
+	"time"
 )
 
 type UpsertBuilder[T any] struct {
@@ -31,9 +36,24 @@ type Upsert struct {
 
 type Inserter[T any] struct {
 	Builder
-	cols   []string
-	values []*T
-	upsert *Upsert
+	cols      []string
+	values    []*T
+	upsert    *Upsert
+	returning []string
+}
+
+func NewInserter[T any](sess Session) *Inserter[T] {
+
+	c := sess.getCore()
+
+	builder := Builder{
+		sess:   sess,
+		core:   c,
+		quoter: c.dialect.quoter(),
+	}
+	return &Inserter[T]{
+		Builder: builder,
+	}
 }
 
 func (i *Inserter[T]) Columns(cols ...string) *Inserter[T] {
@@ -46,6 +66,19 @@ func (i *Inserter[T]) Values(vals ...*T) *Inserter[T] {
 	return i
 }
 
+// Use 添加只作用于这一次查询的 middleware，它们包在 DBWithMiddlewares 设置的 middleware 外面
+func (i *Inserter[T]) Use(mdls ...MiddleWare) *Inserter[T] {
+	i.mdls = append(i.mdls, mdls...)
+	return i
+}
+
+// Returning 指定插入后取回并回填到实体的列，需要方言支持 RETURNING
+// 方言支持 RETURNING 时，即使不调用也会取回数据库生成的自增主键
+func (i *Inserter[T]) Returning(cols ...string) *Inserter[T] {
+	i.returning = cols
+	return i
+}
+
 func (i *Inserter[T]) OnDuplicateKey() *UpsertBuilder[T] {
 	return &UpsertBuilder[T]{
 		i: i,
@@ -58,56 +91,53 @@ func (i *Inserter[T]) Build() (*Stat, error) {
 		return nil, errors.New("插入零行")
 	}
 
-	if i.meta == nil {
-		meta, err := i.registry.Get(i.values[0])
-		if err != nil {
-			return nil, err
-		}
-		i.meta = meta
+	if err := i.init(); err != nil {
+		return nil, err
 	}
 
+	i.builder = &strings.Builder{}
+
+	defer func() {
+		i.builder.Reset()
+		i.args = nil
+	}()
+
 	i.builder.WriteString("INSERT INTO ")
 	i.quote(i.meta.TabName)
 	i.builder.WriteByte('(')
 
-	fds := i.meta.Fields
+	fds, err := i.fields()
 
-	if len(i.cols) > 0 {
-		fds = nil
-		for _, col := range i.cols {
-			fd, ok := i.meta.FieldMap[col]
-			if !ok {
-				return nil, errs.NewErrUnknownField(col)
-			}
-			fds = append(fds, fd)
-		}
+	if err != nil {
+		return nil, err
 	}
 
 	for idx, fd := range fds {
 		if idx > 0 {
 			i.builder.WriteByte(',')
 		}
-		i.builder.WriteString(fd.ColName)
+		i.quote(fd.ColName)
 	}
 
 	i.builder.WriteString(") VALUES ")
 
-	for _, val := range i.values {
+	for vIdx, val := range i.values {
+		if vIdx > 0 {
+			i.builder.WriteByte(',')
+		}
 		i.builder.WriteByte('(')
 		valuer := i.creator(val, i.meta)
 		for idx, fd := range fds {
 			if idx > 0 {
 				i.builder.WriteByte(',')
 			}
-			i.builder.WriteByte('?')
-
 			f, err := valuer.GetField(fd.GoName)
 
 			if err != nil {
 				return nil, err
 			}
 
-			i.addArgs(f)
+			i.buildPlaceholder(f)
 		}
 		i.builder.WriteByte(')')
 	}
@@ -119,8 +149,308 @@ func (i *Inserter[T]) Build() (*Stat, error) {
 		}
 	}
 
+	if err = i.buildReturning(); err != nil {
+		return nil, err
+	}
+
 	return &Stat{
 		Sql:  i.builder.String(),
 		Args: i.args,
 	}, nil
 }
+
+func (i *Inserter[T]) buildReturning() error {
+	fds, err := i.returningFields()
+
+	if err != nil || len(fds) == 0 {
+		return err
+	}
+
+	i.builder.WriteString(" RETURNING ")
+	for idx, fd := range fds {
+		if idx > 0 {
+			i.builder.WriteByte(',')
+		}
+		i.quote(fd.ColName)
+	}
+	return nil
+}
+
+// returningFields 返回 RETURNING 要取回的列
+func (i *Inserter[T]) returningFields() ([]*model.Field, error) {
+	if len(i.returning) > 0 {
+		if !i.dialect.supportReturning() {
+			return nil, errs.ErrUnsupportedReturning
+		}
+		fds := make([]*model.Field, 0, len(i.returning))
+		for _, col := range i.returning {
+			fd, ok := i.meta.FieldMap[col]
+			if !ok {
+				return nil, errs.NewErrUnknownField(col)
+			}
+			fds = append(fds, fd)
+		}
+		return fds, nil
+	}
+
+	if !i.dialect.supportReturning() {
+		return nil, nil
+	}
+
+	gen, err := i.generatedField()
+
+	if err != nil || gen == nil {
+		return nil, err
+	}
+
+	return []*model.Field{gen}, nil
+}
+
+func (i *Inserter[T]) init() error {
+	if i.meta != nil {
+		return nil
+	}
+
+	var t T
+
+	meta, err := i.registry.Get(&t)
+
+	if err != nil {
+		return err
+	}
+
+	i.meta = meta
+
+	return nil
+}
+
+// fields 返回要插入的列，没有指定列时跳过交给数据库生成的自增列
+func (i *Inserter[T]) fields() ([]*model.Field, error) {
+	if len(i.cols) > 0 {
+		fds := make([]*model.Field, 0, len(i.cols))
+		for _, col := range i.cols {
+			fd, ok := i.meta.FieldMap[col]
+			if !ok {
+				return nil, errs.NewErrUnknownField(col)
+			}
+			fds = append(fds, fd)
+		}
+		return fds, nil
+	}
+
+	gen, err := i.generatedField()
+
+	if err != nil {
+		return nil, err
+	}
+
+	fds := make([]*model.Field, 0, len(i.meta.Fields))
+	for _, fd := range i.meta.Fields {
+		if fd == gen {
+			continue
+		}
+		fds = append(fds, fd)
+	}
+	return fds, nil
+}
+
+// generatedField 返回这次插入由数据库生成值的自增列，没有则返回 nil
+// 指定了列但不包含自增列，或者没有指定列且所有行的自增列都是零值时，由数据库生成
+func (i *Inserter[T]) generatedField() (*model.Field, error) {
+	var gen *model.Field
+	for _, fd := range i.meta.Fields {
+		if fd.AutoIncrement {
+			gen = fd
+			break
+		}
+	}
+
+	if gen == nil {
+		return nil, nil
+	}
+
+	if len(i.cols) > 0 {
+		for _, col := range i.cols {
+			if col == gen.GoName {
+				return nil, nil
+			}
+		}
+		return gen, nil
+	}
+
+	for _, val := range i.values {
+		f, err := i.creator(val, i.meta).GetField(gen.GoName)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.ValueOf(f).IsZero() {
+			return nil, nil
+		}
+	}
+
+	return gen, nil
+}
+
+func (i *Inserter[T]) Exec(ctx context.Context) (Result, error) {
+	if err := i.init(); err != nil {
+		return nil, err
+	}
+
+	sess := i.session(ctx)
+
+	qc := &QueryContext{
+		Type:    OpInsert,
+		builder: i,
+		Model:   i.meta,
+	}
+
+	if i.meta.Hooks.Has(model.HookBeforeInsert) {
+		for _, val := range i.values {
+			if err := any(val).(BeforeInsertHook).BeforeInsert(ctx, sess); err != nil {
+				return nil, i.hookError(qc, err)
+			}
+		}
+	}
+
+	start := time.Now()
+	res := i.execute(ctx, qc, i.handler())
+
+	if res.Err != nil {
+		return nil, res.Err
+	}
+
+	result := res.Result.(Result)
+
+	if _, ok := result.(returningResult); !ok {
+		// 语句已经执行成功，回填和 AfterInsert 失败同样带上语句
+		if err := i.fillIds(result); err != nil {
+			return result, i.queryError(qc, err, time.Since(start))
+		}
+	}
+
+	if i.meta.Hooks.Has(model.HookAfterInsert) {
+		for _, val := range i.values {
+			if err := any(val).(AfterInsertHook).AfterInsert(ctx, sess); err != nil {
+				return result, i.queryError(qc, err, time.Since(start))
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (i *Inserter[T]) handler() HandleFunc {
+	return func(ctx context.Context, qc *QueryContext) *QueryResult {
+		stat, err := qc.Query()
+
+		if err != nil {
+			return &QueryResult{
+				Result: nil,
+				Err:    err,
+			}
+		}
+
+		fds, err := i.returningFields()
+
+		if err != nil {
+			return &QueryResult{
+				Result: nil,
+				Err:    err,
+			}
+		}
+
+		if len(fds) > 0 {
+			res, err := i.queryReturning(ctx, stat)
+			return &QueryResult{
+				Result: res,
+				Err:    err,
+			}
+		}
+
+		res, err := i.session(ctx).ExecContext(ctx, stat.Sql, stat.Args...)
+
+		return &QueryResult{
+			Result: res,
+			Err:    err,
+		}
+	}
+}
+
+// queryReturning 执行带 RETURNING 的插入，按插入顺序把返回的列回填到实体
+func (i *Inserter[T]) queryReturning(ctx context.Context, stat *Stat) (Result, error) {
+	rows, err := i.session(ctx).QueryContext(ctx, stat.Sql, stat.Args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var affected int64
+	for rows.Next() {
+		if affected >= int64(len(i.values)) {
+			break
+		}
+		err = i.creator(i.values[affected], i.meta).SetColumns(rows)
+		if err != nil {
+			return nil, err
+		}
+		affected++
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return returningResult{affected: affected}, nil
+}
+
+// fillIds 把数据库生成的自增主键回填到插入的实体
+func (i *Inserter[T]) fillIds(res Result) error {
+	gen, err := i.generatedField()
+
+	if err != nil || gen == nil {
+		return err
+	}
+
+	// 批量 upsert 时无法知道哪些行是插入的
+	if i.upsert != nil && len(i.values) > 1 {
+		return nil
+	}
+
+	lastId, err := res.LastInsertId()
+
+	if err != nil {
+		return err
+	}
+
+	ids, ok := i.dialect.insertIds(lastId, len(i.values), i.upsert != nil)
+
+	if !ok {
+		return nil
+	}
+
+	for idx, val := range i.values {
+		err = i.creator(val, i.meta).SetField(gen.GoName, ids[idx])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// returningResult 带 RETURNING 的插入结果，主键已经回填到实体
+type returningResult struct {
+	affected int64
+}
+
+func (r returningResult) LastInsertId() (int64, error) {
+	return 0, errs.ErrNoLastInsertId
+}
+
+func (r returningResult) RowsAffected() (int64, error) {
+	return r.affected, nil
+}
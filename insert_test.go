@@ -0,0 +1,249 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uzziahlin/orm/internal/errs"
+	"testing"
+)
+
+func TestInserter_Build(t *testing.T) {
+
+	db := memoryDB(t, DBWithDialect(MySQL))
+	sqliteDB := memoryDB(t, DBWithDialect(SQLite3))
+
+	testCases := []struct {
+		name     string
+		builder  SQLBuilder
+		wantStat *Stat
+		wantErr  error
+	}{
+		{
+			name:    "no row",
+			builder: NewInserter[TestModel](db),
+			wantErr: errors.New("插入零行"),
+		},
+		{
+			name:    "single row",
+			builder: NewInserter[TestModel](db).Values(&TestModel{Name: "Jack", Age: 18, TestField: "test"}),
+			wantStat: &Stat{
+				Sql:  "INSERT INTO `test_model`(`name`,`age`,`test_field`) VALUES (?,?,?)",
+				Args: []any{"Jack", 18, "test"},
+			},
+		},
+		{
+			name: "multiple rows",
+			builder: NewInserter[TestModel](db).Values(
+				&TestModel{Name: "Jack", Age: 18, TestField: "test"},
+				&TestModel{Name: "Tom", Age: 19, TestField: "test1"}),
+			wantStat: &Stat{
+				Sql:  "INSERT INTO `test_model`(`name`,`age`,`test_field`) VALUES (?,?,?),(?,?,?)",
+				Args: []any{"Jack", 18, "test", "Tom", 19, "test1"},
+			},
+		},
+		{
+			name:    "columns",
+			builder: NewInserter[TestModel](db).Columns("Name", "Age").Values(&TestModel{Name: "Jack", Age: 18}),
+			wantStat: &Stat{
+				Sql:  "INSERT INTO `test_model`(`name`,`age`) VALUES (?,?)",
+				Args: []any{"Jack", 18},
+			},
+		},
+		{
+			name:    "unknown column",
+			builder: NewInserter[TestModel](db).Columns("Gender").Values(&TestModel{}),
+			wantErr: errs.NewErrUnknownField("Gender"),
+		},
+		{
+			name:    "skip auto increment",
+			builder: NewInserter[AutoIncrementModel](db).Values(&AutoIncrementModel{Name: "Jack"}),
+			wantStat: &Stat{
+				Sql:  "INSERT INTO `auto_increment_model`(`name`) VALUES (?)",
+				Args: []any{"Jack"},
+			},
+		},
+		{
+			name:    "given auto increment",
+			builder: NewInserter[AutoIncrementModel](db).Values(&AutoIncrementModel{Id: 10, Name: "Jack"}),
+			wantStat: &Stat{
+				Sql:  "INSERT INTO `auto_increment_model`(`id`,`name`) VALUES (?,?)",
+				Args: []any{int64(10), "Jack"},
+			},
+		},
+		{
+			name: "upsert",
+			builder: NewInserter[TestModel](db).Values(&TestModel{Name: "Jack", Age: 18, TestField: "test"}).
+				OnDuplicateKey().Update(C("Age")),
+			wantStat: &Stat{
+				Sql:  "INSERT INTO `test_model`(`name`,`age`,`test_field`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `age`=VALUES(`age`)",
+				Args: []any{"Jack", 18, "test"},
+			},
+		},
+		{
+			name: "upsert primary key conflict",
+			builder: NewInserter[AutoIncrementModel](sqliteDB).Values(&AutoIncrementModel{Id: 1, Name: "Jack"}).
+				OnDuplicateKey().Update(C("Name")),
+			wantStat: &Stat{
+				Sql:  `INSERT INTO "auto_increment_model"("id","name") VALUES (?,?) ON CONFLICT("id") DO UPDATE SET "name"=EXCLUDED."name"`,
+				Args: []any{int64(1), "Jack"},
+			},
+		},
+		{
+			name: "upsert conflict columns",
+			builder: NewInserter[AutoIncrementModel](sqliteDB).Values(&AutoIncrementModel{Name: "Jack"}).
+				OnDuplicateKey().ConflictColumns("Name").Update(C("Name")),
+			wantStat: &Stat{
+				Sql:  `INSERT INTO "auto_increment_model"("name") VALUES (?) ON CONFLICT("name") DO UPDATE SET "name"=EXCLUDED."name" RETURNING "id"`,
+				Args: []any{"Jack"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stat, err := tc.builder.Build()
+
+			assert.Equal(t, tc.wantErr, err)
+
+			if err != nil {
+				return
+			}
+
+			assert.Equal(t, tc.wantStat, stat)
+		})
+	}
+}
+
+func TestInserter_Exec(t *testing.T) {
+
+	testCases := []struct {
+		name    string
+		dialect Dialect
+		values  []*AutoIncrementModel
+		upsert  bool
+		mockErr error
+		mockRes Result
+		wantErr error
+		wantIds []int64
+	}{
+		{
+			name:    "exec error",
+			dialect: MySQL,
+			values:  []*AutoIncrementModel{{Name: "Jack"}},
+			mockErr: errors.New("invalid exec"),
+			wantErr: errors.New("invalid exec"),
+			wantIds: []int64{0},
+		},
+		{
+			// 语句执行成功，回填主键失败
+			name:    "last insert id error",
+			dialect: MySQL,
+			values:  []*AutoIncrementModel{{Name: "Jack"}},
+			mockRes: sqlmock.NewErrorResult(errors.New("no last insert id")),
+			wantErr: errors.New("no last insert id"),
+			wantIds: []int64{0},
+		},
+		{
+			name:    "single row",
+			dialect: MySQL,
+			values:  []*AutoIncrementModel{{Name: "Jack"}},
+			mockRes: sqlmock.NewResult(12, 1),
+			wantIds: []int64{12},
+		},
+		{
+			name:    "given id",
+			dialect: MySQL,
+			values:  []*AutoIncrementModel{{Id: 3, Name: "Jack"}},
+			mockRes: sqlmock.NewResult(3, 1),
+			wantIds: []int64{3},
+		},
+		{
+			name:    "mysql multiple rows",
+			dialect: MySQL,
+			values:  []*AutoIncrementModel{{Name: "Jack"}, {Name: "Tom"}, {Name: "Ken"}},
+			mockRes: sqlmock.NewResult(12, 3),
+			wantIds: []int64{12, 13, 14},
+		},
+		{
+			// 走了更新分支，没有生成新的主键
+			name:    "mysql upsert update",
+			dialect: MySQL,
+			values:  []*AutoIncrementModel{{Name: "Jack"}},
+			upsert:  true,
+			mockRes: sqlmock.NewResult(0, 2),
+			wantIds: []int64{0},
+		},
+		{
+			name:    "mysql upsert insert",
+			dialect: MySQL,
+			values:  []*AutoIncrementModel{{Name: "Jack"}},
+			upsert:  true,
+			mockRes: sqlmock.NewResult(12, 1),
+			wantIds: []int64{12},
+		},
+		{
+			// 不知道 LastInsertId 属于哪一行，不回填
+			name:    "standard upsert",
+			dialect: Standard,
+			values:  []*AutoIncrementModel{{Name: "Jack"}},
+			upsert:  true,
+			mockRes: sqlmock.NewResult(12, 1),
+			wantIds: []int64{0},
+		},
+		{
+			name:    "standard multiple rows",
+			dialect: Standard,
+			values:  []*AutoIncrementModel{{Name: "Jack"}, {Name: "Tom"}},
+			mockRes: sqlmock.NewResult(12, 2),
+			wantIds: []int64{0, 0},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = mockDB.Close() }()
+
+			exp := mock.ExpectExec("INSERT INTO .*")
+			if tc.mockErr != nil {
+				exp.WillReturnError(tc.mockErr)
+			} else {
+				exp.WillReturnResult(tc.mockRes)
+			}
+
+			db, err := OpenDB(mockDB, DBWithDialect(tc.dialect))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			i := NewInserter[AutoIncrementModel](db).Values(tc.values...)
+			if tc.upsert {
+				i = i.OnDuplicateKey().Update(C("Name"))
+			}
+			_, err = i.Exec(context.Background())
+			assert.Equal(t, tc.wantErr, queryErrCause(err))
+			if err != nil {
+				var qe *QueryError
+				require.True(t, errors.As(err, &qe))
+				assert.Equal(t, "INSERT INTO `auto_increment_model`(`name`) VALUES (?)", qe.Stat.Sql)
+			}
+
+			ids := make([]int64, 0, len(tc.values))
+			for _, val := range tc.values {
+				ids = append(ids, val.Id)
+			}
+			assert.Equal(t, tc.wantIds, ids)
+		})
+	}
+}
+
+type AutoIncrementModel struct {
+	Id   int64 `orm:"auto_increment"`
+	Name string
+}
@@ -0,0 +1,35 @@
+package clone
+
+import "reflect"
+
+// Result 复制查询结果，避免多个调用方拿到同一个对象：
+// *T 复制一份结构体，[]*T 复制切片和其中每一个元素，其它类型原样返回。
+// 只复制一层，结构体里面的指针、切片和 map 仍然是共享的
+func Result(val any) any {
+	v := reflect.ValueOf(val)
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		return ptr(v).Interface()
+	case reflect.Slice:
+		if v.IsNil() || v.Type().Elem().Kind() != reflect.Pointer {
+			return val
+		}
+		res := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			res.Index(i).Set(ptr(v.Index(i)))
+		}
+		return res.Interface()
+	default:
+		return val
+	}
+}
+
+func ptr(v reflect.Value) reflect.Value {
+	if v.IsNil() {
+		return v
+	}
+	res := reflect.New(v.Type().Elem())
+	res.Elem().Set(v.Elem())
+	return res
+}
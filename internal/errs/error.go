@@ -3,7 +3,6 @@ package errs
 import (
 	"errors"
 	"fmt"
-	"github.com/uzziahlin/orm"
 )
 
 var (
@@ -14,6 +13,12 @@ var (
 	ErrUnknownColumn   = errors.New("orm: 未知字段")
 
 	ErrUnsupportedTableType = errors.New("orm:不支持的表类型")
+
+	ErrUnsupportedAssignable = errors.New("orm: 不支持的赋值表达式")
+	ErrNoUpdatedColumns      = errors.New("orm: 更新语句没有指定列")
+	ErrEmptyValueList        = errors.New("orm: IN 的值列表为空")
+	ErrUnsupportedReturning  = errors.New("orm: 当前方言不支持 RETURNING")
+	ErrNoLastInsertId        = errors.New("orm: RETURNING 插入没有 LastInsertId，主键已经回填到实体")
 )
 
 func NewErrUnsupportedType(typ string) error {
@@ -40,6 +45,6 @@ func NewErrUnknownColumn(col string) error {
 	return fmt.Errorf("%w, %s", ErrUnknownColumn, col)
 }
 
-func NewErrUnsupportedAssignableType(a orm.Assignable) error {
-	return fmt.Errorf("test")
+func NewErrUnsupportedAssignableType(a any) error {
+	return fmt.Errorf("%w, %v", ErrUnsupportedAssignable, a)
 }
@@ -48,3 +48,21 @@ func (r *reflectValuer) GetField(name string) (any, error) {
 
 	return fd.Interface(), nil
 }
+
+func (r *reflectValuer) SetField(name string, val any) error {
+	fd := r.tp.FieldByName(name)
+
+	if fd == (reflect.Value{}) {
+		return errs.NewErrUnknownField(name)
+	}
+
+	v, err := convert(val, fd.Type())
+
+	if err != nil {
+		return err
+	}
+
+	fd.Set(v)
+
+	return nil
+}
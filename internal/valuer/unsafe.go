@@ -56,3 +56,23 @@ func (u *unsafeValuer) GetField(name string) (any, error) {
 
 	return val.Interface(), nil
 }
+
+func (u *unsafeValuer) SetField(name string, val any) error {
+	fd, ok := u.meta.FieldMap[name]
+
+	if !ok {
+		return errs.NewErrUnknownField(name)
+	}
+
+	v, err := convert(val, fd.GoType)
+
+	if err != nil {
+		return err
+	}
+
+	ptr := unsafe.Pointer(uintptr(u.address) + fd.Offset)
+
+	reflect.NewAt(fd.GoType, ptr).Elem().Set(v)
+
+	return nil
+}
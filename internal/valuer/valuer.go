@@ -2,12 +2,40 @@ package valuer
 
 import (
 	"database/sql"
+	"github.com/uzziahlin/orm/internal/errs"
 	"github.com/uzziahlin/orm/model"
+	"reflect"
 )
 
 type Valuer interface {
 	SetColumns(rows *sql.Rows) error
 	GetField(name string) (any, error)
+	SetField(name string, val any) error
 }
 
 type Creator func(tp any, meta *model.Model) Valuer
+
+// convert 把 val 转换成字段类型，只允许可直接赋值或者数值之间的转换
+func convert(val any, typ reflect.Type) (reflect.Value, error) {
+	v := reflect.ValueOf(val)
+
+	if v.Type().AssignableTo(typ) {
+		return v, nil
+	}
+
+	if isNumber(v.Kind()) && isNumber(typ.Kind()) {
+		return v.Convert(typ), nil
+	}
+
+	return reflect.Value{}, errs.NewErrUnsupportedType(typ.String())
+}
+
+func isNumber(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
@@ -3,15 +3,44 @@ package orm
 import (
 	"context"
 	"github.com/uzziahlin/orm/model"
+	"maps"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// QueryContext.Type 的取值
+const (
+	OpSelect = "SELECT"
+	OpInsert = "INSERT"
+	OpUpdate = "UPDATE"
+	OpDelete = "DELETE"
+	OpRaw    = "RAW"
 )
 
 type QueryContext struct {
-	Type    string
+	// Type 语句类型，取值为 OpSelect、OpInsert 等
+	Type string
+	// Model 语句操作的模型
+	Model   *model.Model
 	builder SQLBuilder
-	model   *model.Model
 	stat    *Stat
+	values  map[any]any
+	// resultType Get 是 *T，GetMulti 是 []*T，Iterate 是 *Rows[T]，Exec 为空
+	resultType reflect.Type
+	// tx 语句在事务中执行时不为空
+	tx *Tx
+	// cacheTTL 调用了 WithCache 时大于 0
+	cacheTTL time.Duration
+	// singleflight 调用了 WithSingleflight
+	singleflight bool
+	// stream Iterate 的结果在 Rows.Close 时才释放
+	stream bool
+	// deferred 通过 Defer 注册，结果释放之后执行
+	deferred []func()
 }
 
+// Query 返回要执行的语句，第一次调用时才会构造
 func (qc *QueryContext) Query() (*Stat, error) {
 	if qc.stat != nil {
 		return qc.stat, nil
@@ -21,9 +50,102 @@ func (qc *QueryContext) Query() (*Stat, error) {
 	return qc.stat, err
 }
 
+// SetQuery 替换要执行的语句，例如加上 hint 或者注释
+func (qc *QueryContext) SetQuery(stat *Stat) {
+	qc.stat = stat
+}
+
+// ResultType 返回 QueryResult.Result 的类型，Get 是 *T，GetMulti 是 []*T，Iterate 是 *Rows[T]，Exec 返回 nil。
+// 相同的语句通过 Get 和 GetMulti 执行时结果不同，缓存之类的 middleware 需要区分
+func (qc *QueryContext) ResultType() reflect.Type {
+	return qc.resultType
+}
+
+// Tx 语句在事务中执行时返回这个事务
+func (qc *QueryContext) Tx() (*Tx, bool) {
+	return qc.tx, qc.tx != nil
+}
+
+// CacheTTL 查询调用了 WithCache 时返回缓存的过期时间
+func (qc *QueryContext) CacheTTL() (time.Duration, bool) {
+	return qc.cacheTTL, qc.cacheTTL > 0
+}
+
+// Singleflight 查询是否调用了 WithSingleflight
+func (qc *QueryContext) Singleflight() bool {
+	return qc.singleflight
+}
+
+// Tables 返回语句涉及的表，包括 JOIN 和子查询中的表，Model 的表名在最前面。
+// 语句被 SetQuery 替换时，只返回 Model 的表名
+func (qc *QueryContext) Tables() ([]string, error) {
+	if _, err := qc.Query(); err != nil {
+		return nil, err
+	}
+
+	var tables []string
+	if qc.Model != nil {
+		tables = append(tables, qc.Model.TabName)
+	}
+
+	if r, ok := qc.builder.(tablesReferrer); ok {
+		for _, tab := range r.referencedTables() {
+			if !slices.Contains(tables, tab) {
+				tables = append(tables, tab)
+			}
+		}
+	}
+
+	return tables, nil
+}
+
+// Defer 注册结果释放之后执行的方法，后注册的先执行。
+// Iterate 的结果在 Rows.Close 时释放，其余语句在执行结束时释放。
+// 需要覆盖整个读取过程的 middleware 用它代替 defer，例如取消派生出来的 ctx、结束 span：
+//
+//	ctx, cancel := context.WithTimeout(ctx, d)
+//	qc.Defer(cancel)
+//	return next(ctx, qc)
+func (qc *QueryContext) Defer(fn func()) {
+	qc.deferred = append(qc.deferred, fn)
+}
+
+// Detach 复制出一个独立的 QueryContext 和释放它的方法，副本上通过 Defer 注册的方法只在调用 release 时执行。
+// 把查询交给其他 goroutine 执行的 middleware 使用它，例如 singleflight，这样调用方提前返回时不会释放还在使用的资源
+func (qc *QueryContext) Detach() (detached *QueryContext, release func()) {
+	cp := *qc
+	cp.values = maps.Clone(qc.values)
+	cp.deferred = nil
+	detached = &cp
+	return detached, detached.release
+}
+
+// release 执行 Defer 注册的方法，重复调用不会再次执行
+func (qc *QueryContext) release() {
+	for i := len(qc.deferred) - 1; i >= 0; i-- {
+		qc.deferred[i]()
+	}
+	qc.deferred = nil
+}
+
+// Set 在这次查询中保存数据，用于 middleware 之间传递信息
+func (qc *QueryContext) Set(key, val any) {
+	if qc.values == nil {
+		qc.values = make(map[any]any, 4)
+	}
+	qc.values[key] = val
+}
+
+// Value 读取 Set 保存的数据
+func (qc *QueryContext) Value(key any) (any, bool) {
+	val, ok := qc.values[key]
+	return val, ok
+}
+
 type QueryResult struct {
+	// Result SELECT 是 *T 或者 []*T，其余语句是 Result
 	Result any
-	err    error
+	Err    error
 }
 
 type HandleFunc func(ctx context.Context, qc *QueryContext) *QueryResult
@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/uzziahlin/orm"
+	"github.com/uzziahlin/orm/internal/clone"
+	"time"
+)
+
+var ErrKeyNotFound = errors.New("cache: key 不存在")
+
+// Cache 缓存查询结果，tags 是查询涉及的表，写操作会按照表名让缓存失效
+type Cache interface {
+	// Get key 不存在或者已经过期时返回 ErrKeyNotFound
+	Get(ctx context.Context, key string) (any, error)
+	// Set ttl 小于等于 0 时不过期
+	Set(ctx context.Context, key string, val any, ttl time.Duration, tags ...string) error
+	// Invalidate 删除带有任意一个 tag 的缓存
+	Invalidate(ctx context.Context, tags ...string) error
+	// Clear 删除所有缓存
+	Clear(ctx context.Context) error
+}
+
+// MiddlewareBuilder 缓存调用了 WithCache 的查询结果，
+// INSERT、UPDATE、DELETE 会让语句涉及的表的缓存失效，包括 From 指定的表。
+// 原生语句的 Exec 不知道写了哪些表，会清空整个缓存，可以通过 Use(Tables(...)) 指定。
+// 事务中的查询不走缓存，事务中的写操作在提交之后会再失效一次。
+// 缓存出错时直接查询数据库。
+// key 由语句生成，修改语句的 middleware（例如 opentelemetry 的 SQLComment）要放在它里面
+type MiddlewareBuilder struct {
+	cache Cache
+}
+
+func NewMiddlewareBuilder(cache Cache) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		cache: cache,
+	}
+}
+
+func (b *MiddlewareBuilder) Build() orm.MiddleWare {
+	return func(next orm.HandleFunc) orm.HandleFunc {
+		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			switch {
+			case qc.Type == orm.OpSelect:
+				return b.read(ctx, qc, next)
+			case qc.Type == orm.OpRaw && qc.ResultType() != nil:
+				// 原生查询不缓存
+				return next(ctx, qc)
+			default:
+				return b.write(ctx, qc, next)
+			}
+		}
+	}
+}
+
+func (b *MiddlewareBuilder) read(ctx context.Context, qc *orm.QueryContext, next orm.HandleFunc) *orm.QueryResult {
+	ttl, ok := qc.CacheTTL()
+	if _, inTx := qc.Tx(); !ok || inTx {
+		return next(ctx, qc)
+	}
+
+	stat, err := qc.Query()
+	if err != nil {
+		return &orm.QueryResult{Err: err}
+	}
+
+	key := fmt.Sprintf("orm:%s:%s:%#v", qc.ResultType(), stat.Sql, stat.Args)
+
+	if val, err := b.cache.Get(ctx, key); err == nil {
+		return &orm.QueryResult{Result: clone.Result(val)}
+	}
+
+	res := next(ctx, qc)
+	if res.Err != nil {
+		return res
+	}
+
+	tables, err := qc.Tables()
+	if err != nil {
+		return res
+	}
+
+	_ = b.cache.Set(ctx, key, clone.Result(res.Result), ttl, tables...)
+
+	return res
+}
+
+func (b *MiddlewareBuilder) write(ctx context.Context, qc *orm.QueryContext, next orm.HandleFunc) *orm.QueryResult {
+	res := next(ctx, qc)
+	if res.Err != nil {
+		return res
+	}
+
+	invalidate := b.invalidator(qc)
+	invalidate(ctx)
+
+	// 事务提交前其他连接可能把旧数据写进缓存
+	if tx, ok := qc.Tx(); ok {
+		tx.OnCommit(invalidate)
+	}
+
+	return res
+}
+
+// invalidator 返回让写操作涉及的缓存失效的方法，不确定涉及哪些表时清空整个缓存
+func (b *MiddlewareBuilder) invalidator(qc *orm.QueryContext) func(ctx context.Context) {
+	tables, ok := taggedTables(qc)
+	if !ok && qc.Type != orm.OpRaw {
+		var err error
+		tables, err = qc.Tables()
+		ok = err == nil
+	}
+
+	if !ok {
+		return func(ctx context.Context) {
+			_ = b.cache.Clear(ctx)
+		}
+	}
+
+	return func(ctx context.Context) {
+		_ = b.cache.Invalidate(ctx, tables...)
+	}
+}
+
+type tablesKey struct{}
+
+// Tables 指定写操作涉及的表，只有这些表的缓存失效，主要用于原生语句：
+//
+//	orm.RawQuery[Order](db, "DELETE FROM `order` WHERE `id` = ?", 1).Use(cache.Tables("order")).Exec(ctx)
+func Tables(tables ...string) orm.MiddleWare {
+	return func(next orm.HandleFunc) orm.HandleFunc {
+		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			qc.Set(tablesKey{}, tables)
+			return next(ctx, qc)
+		}
+	}
+}
+
+func taggedTables(qc *orm.QueryContext) ([]string, bool) {
+	val, ok := qc.Value(tablesKey{})
+	if !ok {
+		return nil, false
+	}
+	return val.([]string), true
+}
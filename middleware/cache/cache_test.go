@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uzziahlin/orm"
+	"testing"
+	"time"
+)
+
+type User struct {
+	Id   int64
+	Name string
+}
+
+type Order struct {
+	Id     int64
+	UserId int64
+}
+
+func newDB(t *testing.T) (*orm.DB, sqlmock.Sqlmock, *LRU) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = mockDB.Close() })
+
+	c := NewLRU(100)
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddlewares(NewMiddlewareBuilder(c).Build()))
+	require.NoError(t, err)
+
+	return db, mock, c
+}
+
+func userRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Jack")
+}
+
+func TestMiddlewareBuilder_Read(t *testing.T) {
+	db, mock, c := newDB(t)
+	ctx := context.Background()
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(userRows())
+	mock.ExpectQuery("SELECT .*").WillReturnRows(userRows())
+	mock.ExpectQuery("SELECT .*").WillReturnRows(userRows())
+
+	// 第一次查询数据库，第二次命中缓存
+	u1, err := orm.NewSelector[User](db).Where(orm.C("Id").EQ(1)).WithCache(time.Minute).Get(ctx)
+	require.NoError(t, err)
+	u2, err := orm.NewSelector[User](db).Where(orm.C("Id").EQ(1)).WithCache(time.Minute).Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &User{Id: 1, Name: "Jack"}, u2)
+
+	// 每次拿到的都是副本，修改不会影响缓存
+	assert.NotSame(t, u1, u2)
+	u2.Name = "Tom"
+	u3, err := orm.NewSelector[User](db).Where(orm.C("Id").EQ(1)).WithCache(time.Minute).Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "Jack", u3.Name)
+
+	// 参数不同是不同的 key
+	_, err = orm.NewSelector[User](db).Where(orm.C("Id").EQ(2)).WithCache(time.Minute).Get(ctx)
+	require.NoError(t, err)
+
+	// 同样的语句，GetMulti 和 Get 的结果分开缓存
+	users, err := orm.NewSelector[User](db).Where(orm.C("Id").EQ(1)).WithCache(time.Minute).GetMulti(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*User{{Id: 1, Name: "Jack"}}, users)
+
+	// 没有调用 WithCache 不走缓存
+	mock.ExpectQuery("SELECT .*").WillReturnRows(userRows())
+	_, err = orm.NewSelector[User](db).Where(orm.C("Id").EQ(1)).Get(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, c.Len())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMiddlewareBuilder_Invalidate(t *testing.T) {
+	db, mock, c := newDB(t)
+	ctx := context.Background()
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(userRows())
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(1, 1))
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(1, 1))
+
+	_, err := orm.NewSelector[User](db).WithCache(time.Minute).GetMulti(ctx)
+	require.NoError(t, err)
+	_, err = orm.NewSelector[Order](db).WithCache(time.Minute).GetMulti(ctx)
+	require.NoError(t, err)
+
+	// 子查询中的表也会作为 tag
+	sub := orm.NewSelector[User](db).Select(orm.C("Id")).AsSubQuery("sub")
+	_, err = orm.NewSelector[Order](db).Where(orm.C("UserId").InQuery(sub)).WithCache(time.Minute).GetMulti(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, c.Len())
+
+	// 更新 user 表，user 的查询和子查询都失效
+	mock.ExpectExec("UPDATE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = orm.NewUpdater[User](db).Set(orm.Assign("Name", "Tom")).Where(orm.C("Id").EQ(1)).Exec(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.Len())
+
+	// 原生语句的 Exec 同样会失效
+	mock.ExpectExec("DELETE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = orm.RawQuery[Order](db, "DELETE FROM `order` WHERE `id` = ?", 1).Exec(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, c.Len())
+
+	// 失败的写操作不失效
+	mock.ExpectQuery("SELECT .*").WillReturnRows(userRows())
+	_, err = orm.NewSelector[User](db).WithCache(time.Minute).GetMulti(ctx)
+	require.NoError(t, err)
+	mock.ExpectExec("INSERT .*").WillReturnError(sql.ErrConnDone)
+	_, err = orm.NewInserter[User](db).Values(&User{Id: 2, Name: "Tom"}).Exec(ctx)
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+	assert.Equal(t, 1, c.Len())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMiddlewareBuilder_InvalidateTables(t *testing.T) {
+	db, mock, c := newDB(t)
+	ctx := context.Background()
+
+	cacheAll := func() {
+		mock.ExpectQuery("SELECT .*").WillReturnRows(userRows())
+		mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(1, 1))
+		_, err := orm.NewSelector[User](db).WithCache(time.Minute).GetMulti(ctx)
+		require.NoError(t, err)
+		_, err = orm.NewSelector[Order](db).WithCache(time.Minute).GetMulti(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 2, c.Len())
+	}
+
+	// From 指定的表同样失效，Model 的表也会失效
+	cacheAll()
+	mock.ExpectExec("DELETE FROM `order`.*").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err := orm.NewDeleter[User](db).From(orm.TableOf(&Order{})).Where(orm.C("Id").EQ(1)).Exec(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, c.Len())
+
+	// 没有指定表的原生语句清空整个缓存
+	cacheAll()
+	mock.ExpectExec("DELETE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = orm.RawQuery[User](db, "DELETE FROM `order` WHERE `id` = ?", 1).Exec(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, c.Len())
+
+	// 指定了表的原生语句只让这些表失效
+	cacheAll()
+	mock.ExpectExec("DELETE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = orm.RawQuery[User](db, "DELETE FROM `order` WHERE `id` = ?", 1).Use(Tables("order")).Exec(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.Len())
+	users, err := orm.NewSelector[User](db).WithCache(time.Minute).GetMulti(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*User{{Id: 1, Name: "Jack"}}, users)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMiddlewareBuilder_Tx(t *testing.T) {
+	db, mock, c := newDB(t)
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT .*").WillReturnRows(userRows())
+	mock.ExpectExec("UPDATE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT .*").WillReturnRows(userRows())
+
+	err := db.DoTx(ctx, nil, func(ctx context.Context, tx *orm.Tx) error {
+		// 事务中的查询不缓存
+		_, err := orm.NewSelector[User](tx).WithCache(time.Minute).GetMulti(ctx)
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, 0, c.Len())
+
+		_, err = orm.NewUpdater[User](db).Set(orm.Assign("Name", "Tom")).Where(orm.C("Id").EQ(1)).Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		// 提交之前其他地方把旧数据放进了缓存
+		return c.Set(ctx, "stale", &User{Id: 1, Name: "Jack"}, 0, "user")
+	})
+	require.NoError(t, err)
+
+	// 提交之后再失效一次
+	assert.Equal(t, 0, c.Len())
+
+	_, err = orm.NewSelector[User](db).WithCache(time.Minute).GetMulti(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.Len())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+var _ Cache = &LRU{}
+
+// LRU 内存缓存，超过容量时淘汰最久没有使用的 key
+type LRU struct {
+	mu       sync.Mutex
+	capacity int
+	list     *list.List
+	entries  map[string]*list.Element
+	// tags tag 到 key 的索引
+	tags map[string]map[string]struct{}
+}
+
+type entry struct {
+	key      string
+	val      any
+	deadline time.Time
+	tags     []string
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.deadline.IsZero() && now.After(e.deadline)
+}
+
+// NewLRU capacity 是最多缓存的 key 个数
+func NewLRU(capacity int) *LRU {
+	return &LRU{
+		capacity: capacity,
+		list:     list.New(),
+		entries:  make(map[string]*list.Element, capacity),
+		tags:     make(map[string]map[string]struct{}),
+	}
+}
+
+func (c *LRU) Get(ctx context.Context, key string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	e := elem.Value.(*entry)
+	if e.expired(time.Now()) {
+		c.remove(elem)
+		return nil, ErrKeyNotFound
+	}
+
+	c.list.MoveToFront(elem)
+	return e.val, nil
+}
+
+func (c *LRU) Set(ctx context.Context, key string, val any, ttl time.Duration, tags ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+
+	e := &entry{
+		key:  key,
+		val:  val,
+		tags: tags,
+	}
+	if ttl > 0 {
+		e.deadline = time.Now().Add(ttl)
+	}
+
+	c.entries[key] = c.list.PushFront(e)
+	for _, tag := range tags {
+		keys, ok := c.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+
+	for c.list.Len() > c.capacity {
+		c.remove(c.list.Back())
+	}
+
+	return nil
+}
+
+func (c *LRU) Invalidate(ctx context.Context, tags ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			c.remove(c.entries[key])
+		}
+	}
+
+	return nil
+}
+
+func (c *LRU) Clear(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.list.Init()
+	c.entries = make(map[string]*list.Element, c.capacity)
+	c.tags = make(map[string]map[string]struct{})
+
+	return nil
+}
+
+// Len 返回缓存的 key 个数，包括已经过期但是还没有被清理的 key
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.list.Len()
+}
+
+func (c *LRU) remove(elem *list.Element) {
+	e := c.list.Remove(elem).(*entry)
+	delete(c.entries, e.key)
+	for _, tag := range e.tags {
+		keys := c.tags[tag]
+		delete(keys, e.key)
+		if len(keys) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
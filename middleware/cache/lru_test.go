@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLRU_GetSet(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2)
+
+	_, err := c.Get(ctx, "a")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	require.NoError(t, c.Set(ctx, "a", 1, 0))
+	require.NoError(t, c.Set(ctx, "b", 2, 0))
+
+	val, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, val)
+
+	// b 最久没有使用，被淘汰
+	require.NoError(t, c.Set(ctx, "c", 3, 0))
+	_, err = c.Get(ctx, "b")
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, 2, c.Len())
+
+	// 覆盖已有的 key
+	require.NoError(t, c.Set(ctx, "a", 10, 0))
+	val, err = c.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 10, val)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestLRU_TTL(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10)
+
+	require.NoError(t, c.Set(ctx, "short", 1, 10*time.Millisecond, "user"))
+	require.NoError(t, c.Set(ctx, "long", 2, time.Minute, "user"))
+
+	time.Sleep(20 * time.Millisecond)
+
+	_, err := c.Get(ctx, "short")
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err := c.Get(ctx, "long")
+	require.NoError(t, err)
+	assert.Equal(t, 2, val)
+
+	// 过期的 key 在 Get 时被清理，tag 索引也要一起清理
+	assert.Equal(t, 1, c.Len())
+	assert.Equal(t, map[string]struct{}{"long": {}}, c.tags["user"])
+}
+
+func TestLRU_Invalidate(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10)
+
+	require.NoError(t, c.Set(ctx, "user", 1, 0, "user"))
+	require.NoError(t, c.Set(ctx, "order", 2, 0, "order"))
+	require.NoError(t, c.Set(ctx, "join", 3, 0, "user", "order"))
+	require.NoError(t, c.Set(ctx, "item", 4, 0, "item"))
+
+	require.NoError(t, c.Invalidate(ctx, "order"))
+
+	for _, key := range []string{"order", "join"} {
+		_, err := c.Get(ctx, key)
+		assert.Equal(t, ErrKeyNotFound, err, key)
+	}
+	for _, key := range []string{"user", "item"} {
+		_, err := c.Get(ctx, key)
+		assert.NoError(t, err, key)
+	}
+
+	assert.Equal(t, map[string]map[string]struct{}{
+		"user": {"user": {}},
+		"item": {"item": {}},
+	}, c.tags)
+
+	// 重新设置之后 tag 以新的为准
+	require.NoError(t, c.Set(ctx, "user", 1, 0, "item"))
+	require.NoError(t, c.Invalidate(ctx, "user"))
+	_, err := c.Get(ctx, "user")
+	assert.NoError(t, err)
+}
+
+func TestLRU_Clear(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10)
+
+	require.NoError(t, c.Set(ctx, "user", 1, 0, "user"))
+	require.NoError(t, c.Set(ctx, "order", 2, 0, "order"))
+
+	require.NoError(t, c.Clear(ctx))
+	assert.Equal(t, 0, c.Len())
+	assert.Empty(t, c.tags)
+
+	require.NoError(t, c.Set(ctx, "user", 1, 0, "user"))
+	val, err := c.Get(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, 1, val)
+}
@@ -0,0 +1,27 @@
+package guard
+
+import (
+	"context"
+	"github.com/uzziahlin/orm"
+)
+
+// MiddlewareBuilder 拒绝作用于整张表的语句：没有 WHERE 的 UPDATE、DELETE，
+// 以及大表（model.ModelWithLargeTable）上没有 LIMIT 的 SELECT，返回 *orm.FullTableError。
+// 确实需要操作整张表时调用 AllowFullTable
+type MiddlewareBuilder struct {
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{}
+}
+
+func (b *MiddlewareBuilder) Build() orm.MiddleWare {
+	return func(next orm.HandleFunc) orm.HandleFunc {
+		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			if err := qc.CheckFullTable(); err != nil {
+				return &orm.QueryResult{Err: err}
+			}
+			return next(ctx, qc)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package guard
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uzziahlin/orm"
+	"github.com/uzziahlin/orm/model"
+	"testing"
+)
+
+type User struct {
+	Id   int64
+	Name string
+}
+
+type AuditLog struct {
+	Id      int64
+	Content string
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	reg := model.NewRegistry()
+	_, err = reg.Register(&AuditLog{}, model.ModelWithLargeTable())
+	require.NoError(t, err)
+
+	db, err := orm.OpenDB(mockDB, orm.DBWithRegistry(reg),
+		orm.DBWithMiddlewares(NewMiddlewareBuilder().Build()))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	testCases := []struct {
+		name     string
+		mock     func(mock sqlmock.Sqlmock)
+		exec     func() error
+		wantStat string
+	}{
+		{
+			name: "delete without where",
+			exec: func() error {
+				_, err := orm.NewDeleter[User](db).Exec(ctx)
+				return err
+			},
+			wantStat: "DELETE FROM `user`",
+		},
+		{
+			name: "update without where",
+			exec: func() error {
+				_, err := orm.NewUpdater[User](db).Set(orm.Assign("Name", "Jack")).Exec(ctx)
+				return err
+			},
+			wantStat: "UPDATE `user` SET `name`= ? ",
+		},
+		{
+			name: "select large table without limit",
+			exec: func() error {
+				_, err := orm.NewSelector[AuditLog](db).GetMulti(ctx)
+				return err
+			},
+			wantStat: "SELECT * FROM `audit_log`",
+		},
+		{
+			name: "delete with where",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("DELETE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			exec: func() error {
+				_, err := orm.NewDeleter[User](db).Where(orm.C("Id").EQ(1)).Exec(ctx)
+				return err
+			},
+		},
+		{
+			name: "delete allow full table",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("DELETE .*").WillReturnResult(sqlmock.NewResult(0, 10))
+			},
+			exec: func() error {
+				_, err := orm.NewDeleter[User](db).AllowFullTable().Exec(ctx)
+				return err
+			},
+		},
+		{
+			name: "select small table without limit",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Jack"))
+			},
+			exec: func() error {
+				_, err := orm.NewSelector[User](db).GetMulti(ctx)
+				return err
+			},
+		},
+		{
+			name: "raw query",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("DELETE .*").WillReturnResult(sqlmock.NewResult(0, 10))
+			},
+			exec: func() error {
+				_, err := orm.RawQuery[User](db, "DELETE FROM `user`").Exec(ctx)
+				return err
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.mock != nil {
+				tc.mock(mock)
+			}
+
+			err := tc.exec()
+			if tc.wantStat == "" {
+				assert.NoError(t, err)
+			} else {
+				var fullTableErr *orm.FullTableError
+				require.True(t, errors.As(err, &fullTableErr))
+				assert.Equal(t, tc.wantStat, fullTableErr.Stat.Sql)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"context"
+	"github.com/uzziahlin/orm"
+	"time"
+)
+
+// Metrics 记录查询指标，typ 是 QueryContext.Type，table 是模型的表名
+// 可以对接 Prometheus 等监控系统，参考 prometheus 子包
+type Metrics interface {
+	// IncQuery 查询次数加一
+	IncQuery(typ, table string)
+	// IncError 出错次数加一
+	IncError(typ, table string)
+	// ObserveLatency 记录查询耗时
+	ObserveLatency(typ, table string, duration time.Duration)
+}
+
+type MiddlewareBuilder struct {
+	metrics Metrics
+}
+
+func NewMiddlewareBuilder(metrics Metrics) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		metrics: metrics,
+	}
+}
+
+func (b *MiddlewareBuilder) Build() orm.MiddleWare {
+	return func(next orm.HandleFunc) orm.HandleFunc {
+		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			start := time.Now()
+			res := next(ctx, qc)
+
+			var table string
+			if qc.Model != nil {
+				table = qc.Model.TabName
+			}
+
+			b.metrics.IncQuery(qc.Type, table)
+			if res.Err != nil {
+				b.metrics.IncError(qc.Type, table)
+			}
+
+			// Iterate 的耗时算到 Rows.Close，包括读取的过程
+			qc.Defer(func() {
+				b.metrics.ObserveLatency(qc.Type, table, time.Since(start))
+			})
+
+			return res
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzziahlin/orm"
+	"testing"
+	"time"
+)
+
+type mockMetrics struct {
+	queries   map[string]int
+	errors    map[string]int
+	latencies map[string]int
+}
+
+func newMockMetrics() *mockMetrics {
+	return &mockMetrics{
+		queries:   map[string]int{},
+		errors:    map[string]int{},
+		latencies: map[string]int{},
+	}
+}
+
+func (m *mockMetrics) IncQuery(typ, table string) {
+	m.queries[typ+":"+table]++
+}
+
+func (m *mockMetrics) IncError(typ, table string) {
+	m.errors[typ+":"+table]++
+}
+
+func (m *mockMetrics) ObserveLatency(typ, table string, duration time.Duration) {
+	m.latencies[typ+":"+table]++
+}
+
+type User struct {
+	Id   int64
+	Name string
+}
+
+type Order struct {
+	Id     int64
+	UserId int64
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = mockDB.Close() }()
+
+	m := newMockMetrics()
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddlewares(NewMiddlewareBuilder(m).Build()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Jack"))
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "Tom"))
+	mock.ExpectExec("INSERT .*").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE .*").WillReturnError(errors.New("exec error"))
+	mock.ExpectExec("UPDATE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx := context.Background()
+
+	_, err = orm.NewSelector[User](db).Get(ctx)
+	assert.NoError(t, err)
+	_, err = orm.NewSelector[User](db).GetMulti(ctx)
+	assert.NoError(t, err)
+	_, err = orm.NewInserter[Order](db).Values(&Order{Id: 1, UserId: 1}).Exec(ctx)
+	assert.NoError(t, err)
+	_, err = orm.NewDeleter[Order](db).Where(orm.C("Id").EQ(1)).Exec(ctx)
+	assert.Error(t, err)
+	_, err = orm.RawQuery[User](db, "UPDATE `user` SET `name` = ?", "Jack").Exec(ctx)
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]int{
+		"SELECT:user":  2,
+		"INSERT:order": 1,
+		"DELETE:order": 1,
+		"RAW:user":     1,
+	}, m.queries)
+	assert.Equal(t, m.queries, m.latencies)
+	assert.Equal(t, map[string]int{
+		"DELETE:order": 1,
+	}, m.errors)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMiddlewareBuilder_Iterate(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = mockDB.Close() }()
+
+	m := newMockMetrics()
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddlewares(NewMiddlewareBuilder(m).Build()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Jack"))
+
+	rows, err := orm.NewSelector[User](db).Iterate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]int{"SELECT:user": 1}, m.queries)
+
+	// 耗时在 Close 时记录
+	assert.Empty(t, m.latencies)
+	assert.NoError(t, rows.Close())
+	assert.Equal(t, map[string]int{"SELECT:user": 1}, m.latencies)
+}
@@ -0,0 +1,103 @@
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/uzziahlin/orm/middleware/metrics"
+	"time"
+)
+
+var _ metrics.Metrics = &Metrics{}
+
+// Metrics 使用 Prometheus 实现 metrics.Metrics
+// 指标的 label 是 type 和 table
+type Metrics struct {
+	queries *prometheus.CounterVec
+	errors  *prometheus.CounterVec
+	latency *prometheus.HistogramVec
+}
+
+type Option func(opts *options)
+
+type options struct {
+	namespace string
+	subsystem string
+	buckets   []float64
+}
+
+// WithNamespace 设置指标的 namespace
+func WithNamespace(namespace string) Option {
+	return func(opts *options) {
+		opts.namespace = namespace
+	}
+}
+
+// WithSubsystem 设置指标的 subsystem
+func WithSubsystem(subsystem string) Option {
+	return func(opts *options) {
+		opts.subsystem = subsystem
+	}
+}
+
+// WithBuckets 设置耗时直方图的桶，单位是秒，默认 prometheus.DefBuckets
+func WithBuckets(buckets []float64) Option {
+	return func(opts *options) {
+		opts.buckets = buckets
+	}
+}
+
+// NewMetrics 创建指标并注册到 registerer，
+// 生成的指标为 orm_queries_total、orm_query_errors_total 和 orm_query_duration_seconds
+func NewMetrics(registerer prometheus.Registerer, opts ...Option) (*Metrics, error) {
+	o := &options{
+		namespace: "orm",
+		buckets:   prometheus.DefBuckets,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	labels := []string{"type", "table"}
+
+	m := &Metrics{
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.namespace,
+			Subsystem: o.subsystem,
+			Name:      "queries_total",
+			Help:      "Total number of executed queries.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.namespace,
+			Subsystem: o.subsystem,
+			Name:      "query_errors_total",
+			Help:      "Total number of failed queries.",
+		}, labels),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: o.namespace,
+			Subsystem: o.subsystem,
+			Name:      "query_duration_seconds",
+			Help:      "Query latency in seconds.",
+			Buckets:   o.buckets,
+		}, labels),
+	}
+
+	for _, c := range []prometheus.Collector{m.queries, m.errors, m.latency} {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (m *Metrics) IncQuery(typ, table string) {
+	m.queries.WithLabelValues(typ, table).Inc()
+}
+
+func (m *Metrics) IncError(typ, table string) {
+	m.errors.WithLabelValues(typ, table).Inc()
+}
+
+func (m *Metrics) ObserveLatency(typ, table string, duration time.Duration) {
+	m.latency.WithLabelValues(typ, table).Observe(duration.Seconds())
+}
@@ -0,0 +1,79 @@
+package prometheus
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	m, err := NewMetrics(registry, WithBuckets([]float64{0.01, 0.1, 1}))
+	require.NoError(t, err)
+
+	m.IncQuery("SELECT", "user")
+	m.IncQuery("SELECT", "user")
+	m.IncQuery("DELETE", "order")
+	m.IncError("DELETE", "order")
+	m.ObserveLatency("SELECT", "user", 5*time.Millisecond)
+	m.ObserveLatency("SELECT", "user", 50*time.Millisecond)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	type sample struct {
+		name   string
+		typ    string
+		table  string
+		value  float64
+		counts []uint64
+	}
+
+	var got []sample
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			s := sample{name: family.GetName()}
+			for _, label := range metric.GetLabel() {
+				switch label.GetName() {
+				case "type":
+					s.typ = label.GetValue()
+				case "table":
+					s.table = label.GetValue()
+				}
+			}
+			if c := metric.GetCounter(); c != nil {
+				s.value = c.GetValue()
+			}
+			if h := metric.GetHistogram(); h != nil {
+				s.value = float64(h.GetSampleCount())
+				for _, b := range h.GetBucket() {
+					s.counts = append(s.counts, b.GetCumulativeCount())
+				}
+			}
+			got = append(got, s)
+		}
+	}
+
+	assert.Equal(t, []sample{
+		{name: "orm_queries_total", typ: "DELETE", table: "order", value: 1},
+		{name: "orm_queries_total", typ: "SELECT", table: "user", value: 2},
+		{name: "orm_query_duration_seconds", typ: "SELECT", table: "user", value: 2, counts: []uint64{1, 2, 2}},
+		{name: "orm_query_errors_total", typ: "DELETE", table: "order", value: 1},
+	}, got)
+}
+
+func TestNewMetrics_DuplicateRegister(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	_, err := NewMetrics(registry)
+	require.NoError(t, err)
+
+	_, err = NewMetrics(registry)
+	assert.Error(t, err)
+
+	_, err = NewMetrics(registry, WithSubsystem("read"))
+	assert.NoError(t, err)
+}
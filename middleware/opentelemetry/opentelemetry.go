@@ -0,0 +1,139 @@
+package opentelemetry
+
+import (
+	"context"
+	"github.com/uzziahlin/orm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const instrumentationName = "github.com/uzziahlin/orm/middleware/opentelemetry"
+
+// MiddlewareBuilder 为每条语句创建一个 span，开启 SQLComment 时在 SQL 中带上链路信息
+type MiddlewareBuilder struct {
+	tracer     trace.Tracer
+	system     string
+	comment    bool
+	propagator propagation.TextMapPropagator
+}
+
+// NewMiddlewareBuilder 默认使用全局的 TracerProvider
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		tracer:     otel.GetTracerProvider().Tracer(instrumentationName),
+		system:     semconv.DBSystemOtherSQL.Value.AsString(),
+		propagator: propagation.TraceContext{},
+	}
+}
+
+func (b *MiddlewareBuilder) Tracer(tracer trace.Tracer) *MiddlewareBuilder {
+	b.tracer = tracer
+	return b
+}
+
+// System 设置 db.system，例如 mysql、sqlite、postgresql，默认 other_sql
+func (b *MiddlewareBuilder) System(system string) *MiddlewareBuilder {
+	b.system = system
+	return b
+}
+
+// SQLComment 按照 sqlcommenter 的格式在 SQL 末尾加上 traceparent 注释，
+// 这样数据库的慢查询日志可以关联到链路。
+//
+// 注释通过 SetQuery 写入，之后的 middleware 拿到的语句每次都不一样。
+// 缓存和 singleflight 这类按照语句生成 key 的 middleware 必须放在它的外面，
+// DBWithMiddlewares 中后面的在外层，所以要放在它后面：
+//
+//	orm.DBWithMiddlewares(tracing.Build(), singleflight.Build(), cache.Build())
+func (b *MiddlewareBuilder) SQLComment() *MiddlewareBuilder {
+	b.comment = true
+	return b
+}
+
+// Propagator 设置 SQL 注释使用的 propagator，默认 propagation.TraceContext
+func (b *MiddlewareBuilder) Propagator(propagator propagation.TextMapPropagator) *MiddlewareBuilder {
+	b.propagator = propagator
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() orm.MiddleWare {
+	return func(next orm.HandleFunc) orm.HandleFunc {
+		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			attrs := []attribute.KeyValue{
+				semconv.DBSystemKey.String(b.system),
+				semconv.DBOperationKey.String(qc.Type),
+			}
+
+			name := qc.Type
+			if qc.Model != nil {
+				name = name + " " + qc.Model.TabName
+				attrs = append(attrs, semconv.DBSQLTableKey.String(qc.Model.TabName))
+			}
+
+			ctx, span := b.tracer.Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attrs...))
+			// Iterate 的 span 在 Rows.Close 时结束，覆盖读取的过程
+			qc.Defer(func() {
+				span.End()
+			})
+
+			stat, err := qc.Query()
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return &orm.QueryResult{Err: err}
+			}
+
+			span.SetAttributes(semconv.DBStatementKey.String(stat.Sql))
+
+			if b.comment {
+				qc.SetQuery(&orm.Stat{
+					Sql:  b.withComment(ctx, stat.Sql),
+					Args: stat.Args,
+				})
+			}
+
+			res := next(ctx, qc)
+
+			if res.Err != nil {
+				span.RecordError(res.Err)
+				span.SetStatus(codes.Error, res.Err.Error())
+			}
+
+			return res
+		}
+	}
+}
+
+// withComment 把 ctx 中的链路信息以 /*key='value'*/ 的形式加在 SQL 末尾，
+// 没有链路信息时 SQL 不变
+func (b *MiddlewareBuilder) withComment(ctx context.Context, query string) string {
+	carrier := propagation.MapCarrier{}
+	b.propagator.Inject(ctx, carrier)
+
+	if len(carrier) == 0 {
+		return query
+	}
+
+	keys := carrier.Keys()
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, url.QueryEscape(key)+"='"+url.QueryEscape(carrier.Get(key))+"'")
+	}
+
+	comment := "/*" + strings.Join(pairs, ",") + "*/"
+
+	// 注释要放在结尾的分号之前
+	trimmed := strings.TrimRight(query, " ;")
+	return trimmed + " " + comment + query[len(trimmed):]
+}
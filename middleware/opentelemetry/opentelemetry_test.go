@@ -0,0 +1,248 @@
+package opentelemetry
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uzziahlin/orm"
+	"github.com/uzziahlin/orm/middleware/cache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"regexp"
+	"testing"
+	"time"
+)
+
+type User struct {
+	Id   int64
+	Name string
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	mdl := NewMiddlewareBuilder().Tracer(tp.Tracer("test")).System("mysql").Build()
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddlewares(mdl))
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Jack"))
+	mock.ExpectExec("DELETE .*").WillReturnError(errors.New("exec error"))
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+
+	_, err = orm.NewSelector[User](db).Where(orm.C("Id").EQ(1)).Get(ctx)
+	assert.NoError(t, err)
+	_, err = orm.NewDeleter[User](db).Where(orm.C("Id").EQ(1)).Exec(ctx)
+	assert.Error(t, err)
+	// 没有 Where 的 Updater 构造失败，也要记录
+	_, err = orm.NewUpdater[User](db).Exec(ctx)
+	assert.Error(t, err)
+
+	parent.End()
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 4)
+
+	type spanData struct {
+		name   string
+		kind   trace.SpanKind
+		attrs  []attribute.KeyValue
+		status codes.Code
+		events int
+	}
+
+	var got []spanData
+	for _, s := range spans[:3] {
+		assert.Equal(t, parent.SpanContext().SpanID(), s.Parent.SpanID())
+		got = append(got, spanData{
+			name:   s.Name,
+			kind:   s.SpanKind,
+			attrs:  s.Attributes,
+			status: s.Status.Code,
+			events: len(s.Events),
+		})
+	}
+
+	assert.Equal(t, []spanData{
+		{
+			name: "SELECT user",
+			kind: trace.SpanKindClient,
+			attrs: []attribute.KeyValue{
+				attribute.String("db.system", "mysql"),
+				attribute.String("db.operation", "SELECT"),
+				attribute.String("db.sql.table", "user"),
+				attribute.String("db.statement", "SELECT * FROM `user` WHERE `id` =  ?  LIMIT 1"),
+			},
+			status: codes.Unset,
+		},
+		{
+			name: "DELETE user",
+			kind: trace.SpanKindClient,
+			attrs: []attribute.KeyValue{
+				attribute.String("db.system", "mysql"),
+				attribute.String("db.operation", "DELETE"),
+				attribute.String("db.sql.table", "user"),
+				attribute.String("db.statement", "DELETE FROM `user` WHERE `id` =  ? "),
+			},
+			status: codes.Error,
+			events: 1,
+		},
+		{
+			name: "UPDATE user",
+			kind: trace.SpanKindClient,
+			attrs: []attribute.KeyValue{
+				attribute.String("db.system", "mysql"),
+				attribute.String("db.operation", "UPDATE"),
+				attribute.String("db.sql.table", "user"),
+			},
+			status: codes.Error,
+			events: 1,
+		},
+	}, got)
+}
+
+func TestMiddlewareBuilder_SQLComment(t *testing.T) {
+	// 记录实际执行的 SQL
+	var executed []string
+	matcher := sqlmock.QueryMatcherFunc(func(expectedSQL, actualSQL string) error {
+		executed = append(executed, actualSQL)
+		return nil
+	})
+
+	mockDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(matcher))
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	mdl := NewMiddlewareBuilder().Tracer(tp.Tracer("test")).SQLComment().Build()
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddlewares(mdl))
+	require.NoError(t, err)
+
+	mock.ExpectExec("").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, err = orm.NewDeleter[User](db).Where(orm.C("Id").EQ(1)).Exec(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	sc := spans[0].SpanContext
+
+	// traceparent 指向这条语句自己的 span，db.statement 记录的是原始语句
+	want := "DELETE FROM `user` WHERE `id` =  ? /*traceparent='00-" +
+		sc.TraceID().String() + "-" + sc.SpanID().String() + "-01'*/ "
+	assert.Equal(t, []string{want}, executed)
+	assert.Contains(t, spans[0].Attributes,
+		attribute.String("db.statement", "DELETE FROM `user` WHERE `id` =  ? "))
+}
+
+func TestMiddlewareBuilder_SQLCommentWithCache(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	// 缓存在外层，key 由没有注释的语句生成
+	tracing := NewMiddlewareBuilder().Tracer(tp.Tracer("test")).SQLComment().Build()
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddlewares(tracing, cache.NewMiddlewareBuilder(cache.NewLRU(10)).Build()))
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Jack"))
+
+	for i := 0; i < 2; i++ {
+		ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+		u, err := orm.NewSelector[User](db).Where(orm.C("Id").EQ(1)).WithCache(time.Minute).Get(ctx)
+		span.End()
+		require.NoError(t, err)
+		assert.Equal(t, &User{Id: 1, Name: "Jack"}, u)
+	}
+
+	// 第二次命中缓存，没有执行语句
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMiddlewareBuilder_Iterate(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddlewares(NewMiddlewareBuilder().Tracer(tp.Tracer("test")).Build()))
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Jack"))
+
+	rows, err := orm.NewSelector[User](db).Iterate(context.Background())
+	require.NoError(t, err)
+	for rows.Next() {
+		_, err = rows.Scan()
+		require.NoError(t, err)
+	}
+
+	// 读取完之前 span 没有结束
+	assert.Empty(t, exporter.GetSpans())
+	require.NoError(t, rows.Close())
+	assert.Len(t, exporter.GetSpans(), 1)
+}
+
+func TestMiddlewareBuilder_withComment(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	b := NewMiddlewareBuilder()
+
+	testCases := []struct {
+		name  string
+		ctx   func() context.Context
+		query string
+		want  *regexp.Regexp
+	}{
+		{
+			name:  "no span",
+			ctx:   context.Background,
+			query: "SELECT * FROM `user`;",
+			want:  regexp.MustCompile("^SELECT \\* FROM `user`;$"),
+		},
+		{
+			name: "semicolon",
+			ctx: func() context.Context {
+				ctx, _ := tp.Tracer("test").Start(context.Background(), "test")
+				return ctx
+			},
+			query: "SELECT * FROM `user`;",
+			want:  regexp.MustCompile("^SELECT \\* FROM `user` /\\*traceparent='00-[0-9a-f]{32}-[0-9a-f]{16}-01'\\*/;$"),
+		},
+		{
+			name: "trailing space",
+			ctx: func() context.Context {
+				ctx, _ := tp.Tracer("test").Start(context.Background(), "test")
+				return ctx
+			},
+			query: "DELETE FROM `user` WHERE `id` =  ? ",
+			want:  regexp.MustCompile("^DELETE FROM `user` WHERE `id` =  \\? /\\*traceparent='00-[0-9a-f]{32}-[0-9a-f]{16}-01'\\*/ $"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := b.withComment(tc.ctx(), tc.query)
+			assert.Regexp(t, tc.want, got)
+		})
+	}
+}
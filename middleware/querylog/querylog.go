@@ -0,0 +1,119 @@
+package querylog
+
+import (
+	"context"
+	"github.com/uzziahlin/orm"
+	"log/slog"
+	"reflect"
+	"time"
+)
+
+// Logger 输出查询日志，*slog.Logger 可以直接使用
+type Logger interface {
+	LogAttrs(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr)
+}
+
+type MiddlewareBuilder struct {
+	logger        Logger
+	slowThreshold time.Duration
+	redactArgs    bool
+}
+
+// NewMiddlewareBuilder 默认使用 slog.Default() 输出日志
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		logger: slog.Default(),
+	}
+}
+
+func (b *MiddlewareBuilder) Logger(logger Logger) *MiddlewareBuilder {
+	b.logger = logger
+	return b
+}
+
+// SlowThreshold 执行时间超过 threshold 的查询使用 Warn 级别输出，0 表示不区分慢查询
+func (b *MiddlewareBuilder) SlowThreshold(threshold time.Duration) *MiddlewareBuilder {
+	b.slowThreshold = threshold
+	return b
+}
+
+// RedactArgs 不输出参数，避免把敏感数据写进日志
+func (b *MiddlewareBuilder) RedactArgs() *MiddlewareBuilder {
+	b.redactArgs = true
+	return b
+}
+
+func (b *MiddlewareBuilder) Build() orm.MiddleWare {
+	return func(next orm.HandleFunc) orm.HandleFunc {
+		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			start := time.Now()
+			res := next(ctx, qc)
+			duration := time.Since(start)
+
+			attrs := make([]slog.Attr, 0, 7)
+			attrs = append(attrs, slog.String("type", qc.Type))
+			if qc.Model != nil {
+				attrs = append(attrs, slog.String("table", qc.Model.TabName))
+			}
+
+			// 放在 next 之后读取，这样能拿到其他 middleware 改写之后的语句
+			if stat, err := qc.Query(); err == nil {
+				attrs = append(attrs, slog.String("sql", stat.Sql))
+				if b.redactArgs {
+					attrs = append(attrs, slog.String("args", "<redacted>"))
+				} else {
+					attrs = append(attrs, slog.Any("args", stat.Args))
+				}
+			}
+
+			attrs = append(attrs, slog.Duration("duration", duration))
+
+			if rows, ok := rowsOf(res); ok {
+				attrs = append(attrs, slog.Int64("rows", rows))
+			}
+
+			level, msg := slog.LevelInfo, "orm: query"
+			switch {
+			case res.Err != nil:
+				attrs = append(attrs, slog.String("error", res.Err.Error()))
+				level, msg = slog.LevelError, "orm: query failed"
+			case b.slowThreshold > 0 && duration >= b.slowThreshold:
+				level, msg = slog.LevelWarn, "orm: slow query"
+			}
+
+			b.logger.LogAttrs(ctx, level, msg, attrs...)
+
+			return res
+		}
+	}
+}
+
+// rowsOf 返回影响或者查询到的行数
+func rowsOf(res *orm.QueryResult) (int64, bool) {
+	if res.Err != nil || res.Result == nil {
+		return 0, false
+	}
+
+	if r, ok := res.Result.(orm.Result); ok {
+		rows, err := r.RowsAffected()
+		return rows, err == nil
+	}
+
+	// Iterate 返回的结果集还没有读取，不知道行数
+	if _, ok := res.Result.(interface{ Next() bool }); ok {
+		return 0, false
+	}
+
+	val := reflect.ValueOf(res.Result)
+	switch val.Kind() {
+	case reflect.Slice:
+		return int64(val.Len()), true
+	case reflect.Pointer:
+		if val.IsNil() {
+			return 0, true
+		}
+		return 1, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,179 @@
+package querylog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzziahlin/orm"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+type entry struct {
+	level slog.Level
+	msg   string
+	attrs map[string]any
+}
+
+type mockLogger struct {
+	entries []entry
+}
+
+func (m *mockLogger) LogAttrs(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	e := entry{
+		level: level,
+		msg:   msg,
+		attrs: make(map[string]any, len(attrs)),
+	}
+	for _, attr := range attrs {
+		// duration 每次都不一样，只记录有没有
+		if attr.Key == "duration" {
+			e.attrs[attr.Key] = true
+			continue
+		}
+		e.attrs[attr.Key] = attr.Value.Any()
+	}
+	m.entries = append(m.entries, e)
+}
+
+type User struct {
+	Id   int64
+	Name string
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name      string
+		builder   func(logger Logger) *MiddlewareBuilder
+		mock      func(mock sqlmock.Sqlmock)
+		query     func(ctx context.Context, db *orm.DB) error
+		wantEntry entry
+	}{
+		{
+			name: "select",
+			builder: func(logger Logger) *MiddlewareBuilder {
+				return NewMiddlewareBuilder().Logger(logger)
+			},
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).
+					AddRow(1, "Jack").AddRow(2, "Tom"))
+			},
+			query: func(ctx context.Context, db *orm.DB) error {
+				_, err := orm.NewSelector[User](db).Where(orm.C("Name").Like("%a%")).GetMulti(ctx)
+				return err
+			},
+			wantEntry: entry{
+				level: slog.LevelInfo,
+				msg:   "orm: query",
+				attrs: map[string]any{
+					"type":     orm.OpSelect,
+					"table":    "user",
+					"sql":      "SELECT * FROM `user` WHERE `name` LIKE  ? ",
+					"args":     []any{"%a%"},
+					"duration": true,
+					"rows":     int64(2),
+				},
+			},
+		},
+		{
+			name: "exec error",
+			builder: func(logger Logger) *MiddlewareBuilder {
+				return NewMiddlewareBuilder().Logger(logger)
+			},
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("DELETE .*").WillReturnError(errors.New("exec error"))
+			},
+			query: func(ctx context.Context, db *orm.DB) error {
+				_, err := orm.NewDeleter[User](db).Where(orm.C("Id").EQ(1)).Exec(ctx)
+				return err
+			},
+			wantEntry: entry{
+				level: slog.LevelError,
+				msg:   "orm: query failed",
+				attrs: map[string]any{
+					"type":     orm.OpDelete,
+					"table":    "user",
+					"sql":      "DELETE FROM `user` WHERE `id` =  ? ",
+					"args":     []any{1},
+					"duration": true,
+					"error":    "exec error",
+				},
+			},
+		},
+		{
+			name: "slow query with redacted args",
+			builder: func(logger Logger) *MiddlewareBuilder {
+				return NewMiddlewareBuilder().Logger(logger).SlowThreshold(time.Nanosecond).RedactArgs()
+			},
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE .*").WillDelayFor(time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 3))
+			},
+			query: func(ctx context.Context, db *orm.DB) error {
+				_, err := orm.NewUpdater[User](db).Set(orm.Assign("Name", "secret")).Exec(ctx)
+				return err
+			},
+			wantEntry: entry{
+				level: slog.LevelWarn,
+				msg:   "orm: slow query",
+				attrs: map[string]any{
+					"type":     orm.OpUpdate,
+					"table":    "user",
+					"sql":      "UPDATE `user` SET `name`= ? ",
+					"args":     "<redacted>",
+					"duration": true,
+					"rows":     int64(3),
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = mockDB.Close() }()
+
+			logger := &mockLogger{}
+			db, err := orm.OpenDB(mockDB, orm.DBWithMiddlewares(tc.builder(logger).Build()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tc.mock(mock)
+			_ = tc.query(context.Background(), db)
+
+			assert.Equal(t, []entry{tc.wantEntry}, logger.entries)
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Slog(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = mockDB.Close() }()
+
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(buf, nil))
+
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddlewares(NewMiddlewareBuilder().Logger(logger).Build()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Jack"))
+
+	_, err = orm.NewSelector[User](db).Get(context.Background())
+	assert.NoError(t, err)
+
+	out := buf.String()
+	assert.True(t, strings.Contains(out, `level=INFO msg="orm: query" type=SELECT table=user sql="SELECT * FROM `+"`user`"+` LIMIT 1"`), out)
+	assert.True(t, strings.Contains(out, "rows=1"), out)
+}
@@ -0,0 +1,97 @@
+package singleflight
+
+import (
+	"context"
+	"fmt"
+	"github.com/uzziahlin/orm"
+	"github.com/uzziahlin/orm/internal/clone"
+	"golang.org/x/sync/singleflight"
+	"reflect"
+)
+
+// MiddlewareBuilder 把同时执行的相同查询（SQL 和参数都相同）合并成一次，
+// 每个调用方拿到的都是结果的副本。调用方的 ctx 取消时只有它自己返回，合并的查询继续执行，
+// 所以合并的查询不受任何调用方的超时限制。
+// 合并的查询在独立的 QueryContext 上执行，里面的 middleware 修改语句或者 Set 的数据外层看不到。
+// 只对调用了 WithSingleflight 的查询或者 Models 指定的模型生效，事务中的查询不合并。
+// key 由语句生成，修改语句的 middleware（例如 opentelemetry 的 SQLComment）要放在它里面
+type MiddlewareBuilder struct {
+	models map[reflect.Type]struct{}
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		models: make(map[reflect.Type]struct{}),
+	}
+}
+
+// Models 这些模型的查询都会合并，传入结构体指针，例如 Models(&User{})
+func (b *MiddlewareBuilder) Models(models ...any) *MiddlewareBuilder {
+	for _, m := range models {
+		b.models[reflect.TypeOf(m).Elem()] = struct{}{}
+	}
+	return b
+}
+
+// Build 每次调用都会创建新的 group，一个 DB 使用一个 Build 的结果，不要在多个 DB 之间共享
+func (b *MiddlewareBuilder) Build() orm.MiddleWare {
+	group := &singleflight.Group{}
+	return func(next orm.HandleFunc) orm.HandleFunc {
+		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			if !b.enabled(qc) {
+				return next(ctx, qc)
+			}
+
+			stat, err := qc.Query()
+			if err != nil {
+				return &orm.QueryResult{Err: err}
+			}
+
+			key := fmt.Sprintf("%s:%s:%#v", qc.ResultType(), stat.Sql, stat.Args)
+
+			// 共享的查询不跟随发起者的 ctx 取消，否则一个调用方超时会让所有调用方失败。
+			// 它使用自己的 QueryContext 并在结束时释放，发起者提前返回也不会影响里面的 middleware
+			shared, release := qc.Detach()
+			ch := group.DoChan(key, func() (any, error) {
+				defer release()
+				res := next(context.WithoutCancel(ctx), shared)
+				return res.Result, res.Err
+			})
+
+			select {
+			case <-ctx.Done():
+				return &orm.QueryResult{Err: ctx.Err()}
+			case res := <-ch:
+				if res.Err != nil {
+					return &orm.QueryResult{Err: res.Err}
+				}
+				// 所有调用方都拿副本，包括真正执行查询的那一个
+				return &orm.QueryResult{Result: clone.Result(res.Val)}
+			}
+		}
+	}
+}
+
+func (b *MiddlewareBuilder) enabled(qc *orm.QueryContext) bool {
+	typ := qc.ResultType()
+	if typ == nil {
+		return false
+	}
+
+	if _, inTx := qc.Tx(); inTx {
+		return false
+	}
+
+	if qc.Singleflight() {
+		return true
+	}
+
+	// *T 或者 []*T
+	typ = typ.Elem()
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	_, ok := b.models[typ]
+	return ok
+}
@@ -0,0 +1,296 @@
+package singleflight
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uzziahlin/orm"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type User struct {
+	Id   int64
+	Name string
+}
+
+type Order struct {
+	Id     int64
+	UserId int64
+}
+
+// blocker 在真正执行查询之前阻塞，直到调用 release
+type blocker struct {
+	calls   atomic.Int32
+	arrived atomic.Int32
+	ch      chan struct{}
+}
+
+func newBlocker() *blocker {
+	return &blocker{ch: make(chan struct{})}
+}
+
+// inner 放在 singleflight 里面，统计真正执行的次数
+func (b *blocker) inner(next orm.HandleFunc) orm.HandleFunc {
+	return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+		b.calls.Add(1)
+		<-b.ch
+		return next(ctx, qc)
+	}
+}
+
+// outer 放在 singleflight 外面，统计到达的调用方
+func (b *blocker) outer(next orm.HandleFunc) orm.HandleFunc {
+	return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+		b.arrived.Add(1)
+		return next(ctx, qc)
+	}
+}
+
+// waitAndRelease 等所有调用方都进入 singleflight 之后放行
+func (b *blocker) waitAndRelease(t *testing.T, callers int32) {
+	require.Eventually(t, func() bool {
+		return b.arrived.Load() == callers
+	}, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	close(b.ch)
+}
+
+func newDB(t *testing.T, sf *MiddlewareBuilder, b *blocker) (*orm.DB, sqlmock.Sqlmock) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = mockDB.Close() })
+
+	// 后面的 middleware 在外层
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddlewares(b.inner, sf.Build(), b.outer))
+	require.NoError(t, err)
+	return db, mock
+}
+
+func TestMiddlewareBuilder_Query(t *testing.T) {
+	b := newBlocker()
+	db, mock := newDB(t, NewMiddlewareBuilder(), b)
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Jack"))
+
+	const callers = 5
+	results := make([]*User, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u, err := orm.NewSelector[User](db).Where(orm.C("Id").EQ(1)).WithSingleflight().Get(context.Background())
+			assert.NoError(t, err)
+			results[i] = u
+		}(i)
+	}
+
+	b.waitAndRelease(t, callers)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), b.calls.Load())
+	for i, u := range results {
+		assert.Equal(t, &User{Id: 1, Name: "Jack"}, u)
+		// 每个调用方拿到的都是自己的副本
+		for _, other := range results[:i] {
+			assert.NotSame(t, other, u)
+		}
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMiddlewareBuilder_Cancel(t *testing.T) {
+	b := newBlocker()
+	db, mock := newDB(t, NewMiddlewareBuilder(), b)
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Jack"))
+
+	// 第一个调用方发起查询之后取消
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := orm.NewSelector[User](db).Where(orm.C("Id").EQ(1)).WithSingleflight().Get(ctx)
+		firstErr <- err
+	}()
+	require.Eventually(t, func() bool {
+		return b.calls.Load() == 1
+	}, time.Second, time.Millisecond)
+
+	var (
+		u   *User
+		err error
+		wg  sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		u, err = orm.NewSelector[User](db).Where(orm.C("Id").EQ(1)).WithSingleflight().Get(context.Background())
+	}()
+
+	cancel()
+
+	// 第二个调用方仍然拿到结果
+	b.waitAndRelease(t, 2)
+	wg.Wait()
+	assert.ErrorIs(t, <-firstErr, context.Canceled)
+	require.NoError(t, err)
+	assert.Equal(t, &User{Id: 1, Name: "Jack"}, u)
+	assert.Equal(t, int32(1), b.calls.Load())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMiddlewareBuilder_CancelWithDefer(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	// timeout 在 singleflight 里面，通过 Defer 取消派生出来的 ctx
+	timeout := func(next orm.HandleFunc) orm.HandleFunc {
+		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			ctx, cancel := context.WithTimeout(ctx, time.Minute)
+			qc.Defer(cancel)
+			return next(ctx, qc)
+		}
+	}
+	b := newBlocker()
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddlewares(b.inner, timeout, NewMiddlewareBuilder().Build(), b.outer))
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Jack"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := orm.NewSelector[User](db).Where(orm.C("Id").EQ(1)).WithSingleflight().Get(ctx)
+		firstErr <- err
+	}()
+	require.Eventually(t, func() bool {
+		return b.calls.Load() == 1
+	}, time.Second, time.Millisecond)
+
+	var (
+		u  *User
+		wg sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		u, err = orm.NewSelector[User](db).Where(orm.C("Id").EQ(1)).WithSingleflight().Get(context.Background())
+	}()
+
+	// 发起者返回之后合并的查询才继续执行，它的 ctx 不能被发起者释放
+	cancel()
+	assert.ErrorIs(t, <-firstErr, context.Canceled)
+
+	b.waitAndRelease(t, 2)
+	wg.Wait()
+	require.NoError(t, err)
+	assert.Equal(t, &User{Id: 1, Name: "Jack"}, u)
+	assert.Equal(t, int32(1), b.calls.Load())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMiddlewareBuilder_Models(t *testing.T) {
+	b := newBlocker()
+	db, mock := newDB(t, NewMiddlewareBuilder().Models(&Order{}), b)
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(1, 1).AddRow(2, 1))
+
+	const callers = 3
+	results := make([][]*Order, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			orders, err := orm.NewSelector[Order](db).Where(orm.C("UserId").EQ(1)).GetMulti(context.Background())
+			assert.NoError(t, err)
+			results[i] = orders
+		}(i)
+	}
+
+	b.waitAndRelease(t, callers)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), b.calls.Load())
+	for i, orders := range results {
+		assert.Equal(t, []*Order{{Id: 1, UserId: 1}, {Id: 2, UserId: 1}}, orders)
+		for _, other := range results[:i] {
+			assert.NotSame(t, other[0], orders[0])
+		}
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMiddlewareBuilder_NotApplied(t *testing.T) {
+	testCases := []struct {
+		name  string
+		query func(ctx context.Context, db *orm.DB) error
+		mock  func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name: "not opted in",
+			query: func(ctx context.Context, db *orm.DB) error {
+				_, err := orm.NewSelector[User](db).Where(orm.C("Id").EQ(1)).Get(ctx)
+				return err
+			},
+		},
+		{
+			name: "in tx",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+			},
+			query: func(ctx context.Context, db *orm.DB) error {
+				tx, ok := orm.TxFromContext(ctx)
+				if !ok {
+					return nil
+				}
+				_, err := orm.NewSelector[User](tx).Where(orm.C("Id").EQ(1)).WithSingleflight().Get(ctx)
+				return err
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newBlocker()
+			db, mock := newDB(t, NewMiddlewareBuilder().Models(&Order{}), b)
+			mock.MatchExpectationsInOrder(false)
+
+			ctx := context.Background()
+			if tc.mock != nil {
+				tc.mock(mock)
+				tx, err := db.BeginTx(ctx, nil)
+				require.NoError(t, err)
+				ctx = orm.WithTx(ctx, tx)
+			}
+
+			const callers = 2
+			for i := 0; i < callers; i++ {
+				mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Jack"))
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < callers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					assert.NoError(t, tc.query(ctx, db))
+				}()
+			}
+
+			// 没有合并时两个调用方都会执行到 inner
+			require.Eventually(t, func() bool {
+				return b.calls.Load() == callers
+			}, time.Second, time.Millisecond)
+			close(b.ch)
+			wg.Wait()
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,446 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMiddleware_AllStatements(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = mockDB.Close() }()
+
+	type record struct {
+		typ     string
+		tabName string
+		sql     string
+	}
+
+	var records []record
+	db, err := OpenDB(mockDB, DBWithMiddlewares(func(next HandleFunc) HandleFunc {
+		return func(ctx context.Context, qc *QueryContext) *QueryResult {
+			stat, err := qc.Query()
+			if err != nil {
+				return &QueryResult{Err: err}
+			}
+			records = append(records, record{typ: qc.Type, tabName: qc.Model.TabName, sql: stat.Sql})
+			return next(ctx, qc)
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"name", "age", "test_field"}).AddRow("Jack", 18, "test")
+	}
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	mock.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	mock.ExpectExec("INSERT .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	mock.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	mock.ExpectExec("TRUNCATE .*").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ctx := context.Background()
+
+	_, err = NewSelector[TestModel](db).Get(ctx)
+	assert.NoError(t, err)
+	_, err = NewSelector[TestModel](db).GetMulti(ctx)
+	assert.NoError(t, err)
+	_, err = NewInserter[TestModel](db).Values(&TestModel{Name: "Jack"}).Exec(ctx)
+	assert.NoError(t, err)
+	_, err = NewUpdater[TestModel](db).Set(Assign("Age", 18)).Exec(ctx)
+	assert.NoError(t, err)
+	_, err = NewDeleter[TestModel](db).Where(C("Name").EQ("Jack")).Exec(ctx)
+	assert.NoError(t, err)
+	res, err := RawQuery[TestModel](db, "SELECT * FROM `test_model` WHERE `name` = ?", "Jack").Get(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &TestModel{Name: "Jack", Age: 18, TestField: "test"}, res)
+	multi, err := RawQuery[TestModel](db, "SELECT * FROM `test_model`").GetMulti(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*TestModel{{Name: "Jack", Age: 18, TestField: "test"}}, multi)
+	_, err = RawQuery[TestModel](db, "TRUNCATE `test_model`").Exec(ctx)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []record{
+		{typ: "SELECT", tabName: "test_model", sql: "SELECT * FROM `test_model` LIMIT 1"},
+		{typ: "SELECT", tabName: "test_model", sql: "SELECT * FROM `test_model`"},
+		{typ: "INSERT", tabName: "test_model", sql: "INSERT INTO `test_model`(`name`,`age`,`test_field`) VALUES (?,?,?)"},
+		{typ: "UPDATE", tabName: "test_model", sql: "UPDATE `test_model` SET `age`= ? "},
+		{typ: "DELETE", tabName: "test_model", sql: "DELETE FROM `test_model` WHERE `name` =  ? "},
+		{typ: "RAW", tabName: "test_model", sql: "SELECT * FROM `test_model` WHERE `name` = ?"},
+		{typ: "RAW", tabName: "test_model", sql: "SELECT * FROM `test_model`"},
+		{typ: "RAW", tabName: "test_model", sql: "TRUNCATE `test_model`"},
+	}, records)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryContext_Mutable(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = mockDB.Close() }()
+
+	type traceKey struct{}
+
+	denyErr := errors.New("denied")
+
+	// 第一个 middleware 给 SQL 加上注释，并把 trace id 传给下一个 middleware
+	comment := func(next HandleFunc) HandleFunc {
+		return func(ctx context.Context, qc *QueryContext) *QueryResult {
+			stat, err := qc.Query()
+			if err != nil {
+				return &QueryResult{Err: err}
+			}
+			qc.SetQuery(&Stat{
+				Sql:  "/* trace */ " + stat.Sql,
+				Args: stat.Args,
+			})
+			qc.Set(traceKey{}, "trace-1")
+			return next(ctx, qc)
+		}
+	}
+
+	// 第二个 middleware 拒绝删除 order 表
+	var gotTrace any
+	guard := func(next HandleFunc) HandleFunc {
+		return func(ctx context.Context, qc *QueryContext) *QueryResult {
+			gotTrace, _ = qc.Value(traceKey{})
+			if qc.Type == OpDelete && qc.Model.TabName == "order" {
+				return &QueryResult{Err: denyErr}
+			}
+			return next(ctx, qc)
+		}
+	}
+
+	// 后面的 middleware 在外层，先执行
+	db, err := OpenDB(mockDB, DBWithMiddlewares(guard, comment))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec(`/\* trace \*/ DELETE FROM .test_model.`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx := context.Background()
+
+	_, err = NewDeleter[TestModel](db).Exec(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "trace-1", gotTrace)
+
+	_, err = NewDeleter[Order](db).Exec(ctx)
+	assert.ErrorIs(t, err, denyErr)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryContext_Info(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = mockDB.Close() }()
+
+	type info struct {
+		resultType string
+		tables     []string
+		inTx       bool
+		cacheTTL   time.Duration
+	}
+
+	var infos []info
+	db, err := OpenDB(mockDB, DBWithMiddlewares(func(next HandleFunc) HandleFunc {
+		return func(ctx context.Context, qc *QueryContext) *QueryResult {
+			tables, err := qc.Tables()
+			if err != nil {
+				return &QueryResult{Err: err}
+			}
+			i := info{tables: tables}
+			if typ := qc.ResultType(); typ != nil {
+				i.resultType = typ.String()
+			}
+			_, i.inTx = qc.Tx()
+			i.cacheTTL, _ = qc.CacheTTL()
+			infos = append(infos, i)
+			return next(ctx, qc)
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id"}).AddRow(1)
+	}
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"order_id"}).AddRow("1"))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ctx := context.Background()
+
+	t1 := TableOf(&Order{}).AS("t1")
+	t2 := TableOf(&OrderDetail{}).AS("t2")
+	_, err = NewSelector[Order](db).
+		From(t1.Join(t2).On(t1.C("Id").EQ(t2.C("OrderId")))).
+		WithCache(time.Minute).Get(ctx)
+	assert.NoError(t, err)
+
+	sub := NewSelector[Item](db).Select(C("Id")).AsSubQuery("sub")
+	_, err = NewSelector[OrderDetail](db).Where(C("ItemId").InQuery(sub)).GetMulti(ctx)
+	assert.NoError(t, err)
+
+	err = db.DoTx(ctx, nil, func(ctx context.Context, tx *Tx) error {
+		_, err := NewDeleter[Order](db).Where(C("Id").EQ(1)).Exec(ctx)
+		return err
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []info{
+		{resultType: "*orm.Order", tables: []string{"order", "order_detail"}, cacheTTL: time.Minute},
+		{resultType: "[]*orm.OrderDetail", tables: []string{"order_detail", "item"}},
+		{tables: []string{"order"}, inTx: true},
+	}, infos)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMiddleware_Order(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = mockDB.Close() }()
+
+	var trace []string
+	record := func(name string) MiddleWare {
+		return func(next HandleFunc) HandleFunc {
+			return func(ctx context.Context, qc *QueryContext) *QueryResult {
+				trace = append(trace, name)
+				return next(ctx, qc)
+			}
+		}
+	}
+
+	// DBWithMiddlewares 可以多次使用，追加在后面
+	db, err := OpenDB(mockDB,
+		DBWithMiddlewares(record("db1")),
+		DBWithMiddlewares(record("db2"), record("db3")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"name", "age", "test_field"}).AddRow("Jack", 18, "test")
+	}
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	mock.ExpectQuery("SELECT .*").WillReturnRows(rows())
+	mock.ExpectExec("INSERT .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT .*").WillReturnRows(rows())
+
+	ctx := context.Background()
+
+	testCases := []struct {
+		name      string
+		exec      func() error
+		wantTrace []string
+	}{
+		{
+			// query 级别的包在 DB 级别的外面，同一层里后面的先执行
+			name: "select",
+			exec: func() error {
+				_, err := NewSelector[TestModel](db).Use(record("q1")).Use(record("q2"), record("q3")).Get(ctx)
+				return err
+			},
+			wantTrace: []string{"q3", "q2", "q1", "db3", "db2", "db1"},
+		},
+		{
+			// 不会影响其他查询
+			name: "select without use",
+			exec: func() error {
+				_, err := NewSelector[TestModel](db).GetMulti(ctx)
+				return err
+			},
+			wantTrace: []string{"db3", "db2", "db1"},
+		},
+		{
+			name: "insert",
+			exec: func() error {
+				_, err := NewInserter[TestModel](db).Values(&TestModel{Name: "Jack"}).Use(record("q1")).Exec(ctx)
+				return err
+			},
+			wantTrace: []string{"q1", "db3", "db2", "db1"},
+		},
+		{
+			name: "update",
+			exec: func() error {
+				_, err := NewUpdater[TestModel](db).Set(Assign("Age", 18)).Use(record("q1")).Exec(ctx)
+				return err
+			},
+			wantTrace: []string{"q1", "db3", "db2", "db1"},
+		},
+		{
+			name: "delete",
+			exec: func() error {
+				_, err := NewDeleter[TestModel](db).Use(record("q1")).Exec(ctx)
+				return err
+			},
+			wantTrace: []string{"q1", "db3", "db2", "db1"},
+		},
+		{
+			name: "raw",
+			exec: func() error {
+				_, err := RawQuery[TestModel](db, "SELECT * FROM `test_model`").Use(record("q1")).GetMulti(ctx)
+				return err
+			},
+			wantTrace: []string{"q1", "db3", "db2", "db1"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			trace = nil
+			assert.NoError(t, tc.exec())
+			assert.Equal(t, tc.wantTrace, trace)
+		})
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSelector_Use_Timeout(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = mockDB.Close() }()
+
+	db, err := OpenDB(mockDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := func(d time.Duration) MiddleWare {
+		return func(next HandleFunc) HandleFunc {
+			return func(ctx context.Context, qc *QueryContext) *QueryResult {
+				ctx, cancel := context.WithTimeout(ctx, d)
+				qc.Defer(cancel)
+				return next(ctx, qc)
+			}
+		}
+	}
+
+	mock.ExpectQuery("SELECT .*").WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Jack"))
+
+	// sqlmock 在 ctx 超时后返回它自己的错误
+	start := time.Now()
+	_, err = NewSelector[TestModel](db).Use(timeout(10 * time.Millisecond)).Get(context.Background())
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestQueryContext_Defer(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	var (
+		calls    []string
+		scopeCtx context.Context
+	)
+	scope := func(next HandleFunc) HandleFunc {
+		return func(ctx context.Context, qc *QueryContext) *QueryResult {
+			ctx, cancel := context.WithCancel(ctx)
+			scopeCtx = ctx
+			qc.Defer(func() {
+				calls = append(calls, "cancel")
+				cancel()
+			})
+			qc.Defer(func() {
+				calls = append(calls, "end")
+			})
+			return next(ctx, qc)
+		}
+	}
+
+	db, err := OpenDB(mockDB, DBWithMiddlewares(scope))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	newRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"name", "age", "test_field"}).
+			AddRow([]byte("Jack"), []byte("18"), []byte("test"))
+	}
+
+	// 普通查询执行结束就释放，后注册的先执行
+	mock.ExpectQuery("SELECT .*").WillReturnRows(newRows())
+	_, err = NewSelector[TestModel](db).GetMulti(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"end", "cancel"}, calls)
+
+	// Iterate 推迟到 Close，读取过程中 middleware 派生的 ctx 一直有效
+	calls = nil
+	mock.ExpectQuery("SELECT .*").WillReturnRows(newRows())
+	rows, err := NewSelector[TestModel](db).Iterate(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, calls)
+	assert.NoError(t, scopeCtx.Err())
+	require.True(t, rows.Next())
+	_, err = rows.Scan()
+	require.NoError(t, err)
+
+	require.NoError(t, rows.Close())
+	assert.Equal(t, []string{"end", "cancel"}, calls)
+	assert.ErrorIs(t, scopeCtx.Err(), context.Canceled)
+
+	// 重复 Close 不会重复执行
+	require.NoError(t, rows.Close())
+	assert.Equal(t, []string{"end", "cancel"}, calls)
+
+	// Iterate 执行失败时立即释放
+	calls = nil
+	mock.ExpectQuery("SELECT .*").WillReturnError(errors.New("invalid query"))
+	_, err = NewSelector[TestModel](db).Iterate(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"end", "cancel"}, calls)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryContext_Detach(t *testing.T) {
+	var calls []string
+	qc := &QueryContext{Type: OpSelect}
+	qc.Set("key", "val")
+	qc.Defer(func() { calls = append(calls, "origin") })
+
+	detached, release := qc.Detach()
+	detached.Set("key", "detached")
+	detached.Defer(func() { calls = append(calls, "detached") })
+
+	// 两边的数据和 Defer 互不影响
+	val, _ := qc.Value("key")
+	assert.Equal(t, "val", val)
+	assert.Equal(t, OpSelect, detached.Type)
+
+	qc.release()
+	assert.Equal(t, []string{"origin"}, calls)
+
+	release()
+	release()
+	assert.Equal(t, []string{"origin", "detached"}, calls)
+}
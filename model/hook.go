@@ -0,0 +1,18 @@
+package model
+
+// Hook 实体实现的生命周期钩子，可以按位组合。
+// 钩子的接口定义在 orm 包，由 orm 在注册模型时检测，model 包只负责保存结果
+type Hook uint8
+
+const (
+	HookBeforeInsert Hook = 1 << iota
+	HookAfterInsert
+	HookBeforeUpdate
+	HookAfterFind
+	HookBeforeDelete
+)
+
+// Has 是否包含 hook
+func (h Hook) Has(hook Hook) bool {
+	return h&hook != 0
+}
@@ -9,13 +9,31 @@ type Model struct {
 	FieldMap  map[string]*Field
 	ColumnMap map[string]*Field
 	Fields    []*Field
+	// PrimaryKeys 主键列，按字段声明顺序排列
+	PrimaryKeys []*Field
+	// Large 大表，开启全表保护时 SELECT 必须带 LIMIT
+	Large bool
+	// Hooks 实体实现的生命周期钩子，通过 orm 注册时才会检测
+	Hooks Hook
 }
 
 type Option func(m *Model) error
 
+// ModelWithLargeTable 把表标记为大表
+func ModelWithLargeTable() Option {
+	return func(m *Model) error {
+		m.Large = true
+		return nil
+	}
+}
+
 type Field struct {
 	GoName  string
 	ColName string
 	GoType  reflect.Type
 	Offset  uintptr
+	// PrimaryKey 是否为主键列
+	PrimaryKey bool
+	// AutoIncrement 列的值由数据库生成，插入后会回填到结构体
+	AutoIncrement bool
 }
@@ -12,8 +12,17 @@ const (
 	tagName = "orm"
 
 	columnTag = "column"
+
+	primaryKeyTag    = "pk"
+	autoIncrementTag = "auto_increment"
 )
 
+// flagTags 不需要值的tag，例如 orm:"column=id,auto_increment"
+var flagTags = map[string]struct{}{
+	primaryKeyTag:    {},
+	autoIncrementTag: {},
+}
+
 type TableNamer interface {
 	TableName() string
 }
@@ -115,9 +124,48 @@ func (p *parser) parseModel() (*Model, error) {
 	model.FieldMap = fieldMap
 	model.ColumnMap = columnMap
 
+	p.parsePrimaryKeys(model)
+
 	return model, nil
 }
 
+// parsePrimaryKeys 收集主键列，没有字段声明 pk 时使用名为 Id 或 ID 的字段
+// 使用默认主键且它是整数、模型也没有声明自增列时，认为它是自增主键
+func (p *parser) parsePrimaryKeys(model *Model) {
+	for _, fd := range model.Fields {
+		if fd.PrimaryKey {
+			model.PrimaryKeys = append(model.PrimaryKeys, fd)
+		}
+	}
+
+	if len(model.PrimaryKeys) > 0 {
+		return
+	}
+
+	fd, ok := model.FieldMap["Id"]
+	if !ok {
+		fd, ok = model.FieldMap["ID"]
+	}
+	if !ok {
+		return
+	}
+
+	fd.PrimaryKey = true
+	model.PrimaryKeys = []*Field{fd}
+
+	for _, f := range model.Fields {
+		if f.AutoIncrement {
+			return
+		}
+	}
+
+	switch fd.GoType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		fd.AutoIncrement = true
+	}
+}
+
 func (p *parser) parseModelInfo() (*Model, error) {
 
 	var m Model
@@ -148,11 +196,16 @@ func (p *parser) parseFieldInfo(fd reflect.StructField) (*Field, error) {
 		col = utils.CamelToUnderLine(fd.Name)
 	}
 
+	_, pk := tags[primaryKeyTag]
+	_, autoIncrement := tags[autoIncrementTag]
+
 	return &Field{
-		GoName:  fd.Name,
-		ColName: col,
-		GoType:  fd.Type,
-		Offset:  fd.Offset,
+		GoName:        fd.Name,
+		ColName:       col,
+		GoType:        fd.Type,
+		Offset:        fd.Offset,
+		PrimaryKey:    pk,
+		AutoIncrement: autoIncrement,
 	}, nil
 
 }
@@ -169,6 +222,11 @@ func (p *parser) parseTag(tag reflect.StructTag) (map[string]string, error) {
 	res := make(map[string]string, len(pairs))
 
 	for _, pair := range pairs {
+		if _, ok := flagTags[pair]; ok {
+			res[pair] = ""
+			continue
+		}
+
 		segs := strings.Split(pair, "=")
 
 		if len(segs) != 2 {
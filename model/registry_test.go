@@ -1,7 +1,7 @@
 package model
 
 import (
-	"go-train/orm/internal/errs"
+	"github.com/uzziahlin/orm/internal/errs"
 	"reflect"
 	"testing"
 
@@ -111,6 +111,140 @@ func TestRegistry_Get(t *testing.T) {
 				TabName: "test_model",
 			},
 		},
+		{
+			name:     "entity with auto increment",
+			registry: NewRegistry(),
+			m: func() any {
+
+				type TestModel struct {
+					Id   int64 `orm:"column=uid,auto_increment"`
+					Name string
+				}
+
+				return &TestModel{}
+			}(),
+			wantFields: []*Field{
+				{
+					GoName:        "Id",
+					ColName:       "uid",
+					GoType:        reflect.TypeOf(int64(0)),
+					Offset:        uintptr(0),
+					PrimaryKey:    true,
+					AutoIncrement: true,
+				},
+				{
+					GoName:  "Name",
+					ColName: "name",
+					GoType:  reflect.TypeOf(""),
+					Offset:  uintptr(8),
+				},
+			},
+			wantModel: &Model{
+				TabName: "test_model",
+			},
+		},
+		{
+			name:     "entity with primary keys",
+			registry: NewRegistry(),
+			m: func() any {
+
+				type TestModel struct {
+					Id      int64
+					OrderId int64 `orm:"pk"`
+					ItemId  int64 `orm:"column=sku_id,pk"`
+				}
+
+				return &TestModel{}
+			}(),
+			wantFields: []*Field{
+				{
+					GoName:  "Id",
+					ColName: "id",
+					GoType:  reflect.TypeOf(int64(0)),
+					Offset:  uintptr(0),
+				},
+				{
+					GoName:     "OrderId",
+					ColName:    "order_id",
+					GoType:     reflect.TypeOf(int64(0)),
+					Offset:     uintptr(8),
+					PrimaryKey: true,
+				},
+				{
+					GoName:     "ItemId",
+					ColName:    "sku_id",
+					GoType:     reflect.TypeOf(int64(0)),
+					Offset:     uintptr(16),
+					PrimaryKey: true,
+				},
+			},
+			wantModel: &Model{
+				TabName: "test_model",
+			},
+		},
+		{
+			name:     "default integer primary key",
+			registry: NewRegistry(),
+			m: func() any {
+
+				type TestModel struct {
+					ID   uint
+					Name string
+				}
+
+				return &TestModel{}
+			}(),
+			wantFields: []*Field{
+				{
+					GoName:        "ID",
+					ColName:       "i_d",
+					GoType:        reflect.TypeOf(uint(0)),
+					Offset:        uintptr(0),
+					PrimaryKey:    true,
+					AutoIncrement: true,
+				},
+				{
+					GoName:  "Name",
+					ColName: "name",
+					GoType:  reflect.TypeOf(""),
+					Offset:  uintptr(8),
+				},
+			},
+			wantModel: &Model{
+				TabName: "test_model",
+			},
+		},
+		{
+			name:     "default string primary key",
+			registry: NewRegistry(),
+			m: func() any {
+
+				type TestModel struct {
+					Id   string
+					Name string
+				}
+
+				return &TestModel{}
+			}(),
+			wantFields: []*Field{
+				{
+					GoName:     "Id",
+					ColName:    "id",
+					GoType:     reflect.TypeOf(""),
+					Offset:     uintptr(0),
+					PrimaryKey: true,
+				},
+				{
+					GoName:  "Name",
+					ColName: "name",
+					GoType:  reflect.TypeOf(""),
+					Offset:  uintptr(16),
+				},
+			},
+			wantModel: &Model{
+				TabName: "test_model",
+			},
+		},
 		{
 			name:     "entity with invalid tag",
 			registry: NewRegistry(),
@@ -139,6 +273,12 @@ func TestRegistry_Get(t *testing.T) {
 				}
 				tc.wantModel.FieldMap = fieldMap
 				tc.wantModel.ColumnMap = columnMap
+				tc.wantModel.Fields = tc.wantFields
+				for _, field := range tc.wantFields {
+					if field.PrimaryKey {
+						tc.wantModel.PrimaryKeys = append(tc.wantModel.PrimaryKeys, field)
+					}
+				}
 			}
 
 			model, err := tc.registry.Get(tc.m)
@@ -151,3 +291,25 @@ func TestRegistry_Get(t *testing.T) {
 	}
 
 }
+
+func TestRegistry_Register_Options(t *testing.T) {
+	type LogEntry struct {
+		Id      int64
+		Content string
+	}
+
+	r := NewRegistry()
+
+	m, err := r.Register(&LogEntry{}, ModelWithLargeTable())
+	assert.NoError(t, err)
+	assert.True(t, m.Large)
+
+	// Get 拿到的是注册时的元数据
+	m, err = r.Get(&LogEntry{})
+	assert.NoError(t, err)
+	assert.True(t, m.Large)
+
+	m, err = NewRegistry().Get(&LogEntry{})
+	assert.NoError(t, err)
+	assert.False(t, m.Large)
+}
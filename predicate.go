@@ -7,15 +7,23 @@ func (o op) String() string {
 }
 
 const (
-	opEQ     op = "="
-	opNOT    op = "NOT"
-	opAND    op = "AND"
-	opLT     op = "<"
-	opLE     op = "<="
-	opGT     op = ">"
-	opGE     op = ">="
-	opIN     op = "IN"
-	opExists op = "EXIST"
+	opEQ        op = "="
+	opNE        op = "!="
+	opNOT       op = "NOT"
+	opAND       op = "AND"
+	opOR        op = "OR"
+	opLT        op = "<"
+	opLE        op = "<="
+	opGT        op = ">"
+	opGE        op = ">="
+	opIN        op = "IN"
+	opNotIN     op = "NOT IN"
+	opLike      op = "LIKE"
+	opNotLike   op = "NOT LIKE"
+	opBetween   op = "BETWEEN"
+	opIsNull    op = "IS NULL"
+	opIsNotNull op = "IS NOT NULL"
+	opExists    op = "EXIST"
 )
 
 type Predicate struct {
@@ -37,7 +45,7 @@ func (p Predicate) AND(cond Predicate) Predicate {
 func (p Predicate) OR(cond Predicate) Predicate {
 	return Predicate{
 		left:  p,
-		op:    opAND,
+		op:    opOR,
 		right: cond,
 	}
 }
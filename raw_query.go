@@ -0,0 +1,89 @@
+package orm
+
+import (
+	"context"
+)
+
+// RawQuerier 执行原生 SQL，结果按照 T 的元数据映射
+type RawQuerier[T any] struct {
+	Builder
+	sql  string
+	args []any
+}
+
+// RawQuery 构造原生查询，同样会经过 middleware
+// RawQuery[User](db, "SELECT * FROM `user` WHERE `id` = ?", 1).Get(ctx)
+func RawQuery[T any](sess Session, query string, args ...any) *RawQuerier[T] {
+
+	c := sess.getCore()
+
+	builder := Builder{
+		sess:   sess,
+		core:   c,
+		quoter: c.dialect.quoter(),
+	}
+	return &RawQuerier[T]{
+		Builder: builder,
+		sql:     query,
+		args:    args,
+	}
+}
+
+// Use 添加只作用于这一次查询的 middleware，它们包在 DBWithMiddlewares 设置的 middleware 外面
+func (r *RawQuerier[T]) Use(mdls ...MiddleWare) *RawQuerier[T] {
+	r.mdls = append(r.mdls, mdls...)
+	return r
+}
+
+func (r *RawQuerier[T]) Build() (*Stat, error) {
+	return &Stat{
+		Sql:  r.sql,
+		Args: r.args,
+	}, nil
+}
+
+func (r *RawQuerier[T]) Get(ctx context.Context) (*T, error) {
+	qc, err := r.queryContext()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return get[T](ctx, &r.Builder, qc)
+}
+
+func (r *RawQuerier[T]) GetMulti(ctx context.Context) ([]*T, error) {
+	qc, err := r.queryContext()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getMulti[T](ctx, &r.Builder, qc)
+}
+
+func (r *RawQuerier[T]) Exec(ctx context.Context) (Result, error) {
+	qc, err := r.queryContext()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.exec(ctx, qc)
+}
+
+func (r *RawQuerier[T]) queryContext() (*QueryContext, error) {
+	var t T
+
+	meta, err := r.registry.Get(&t)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &QueryContext{
+		Type:    OpRaw,
+		builder: r,
+		Model:   meta,
+	}, nil
+}
@@ -0,0 +1,159 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// RetryPolicy 事务的重试策略，重试时会重新执行整个事务
+type RetryPolicy struct {
+	// MaxAttempts 最多执行的次数，包括第一次
+	MaxAttempts int
+	// Backoff 第一次重试前等待的时间，之后每次翻倍
+	Backoff time.Duration
+	// MaxBackoff 等待时间的上限，0 表示不限制
+	MaxBackoff time.Duration
+	// Retryable 判断错误是否可以重试，为 nil 时使用 DefaultRetryable
+	Retryable func(err error) bool
+}
+
+// wait 第 attempt 次失败后需要等待的时间，在 [d/2, d] 之间随机，避免多个事务同时重试
+func (p RetryPolicy) wait(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return DefaultRetryable(err)
+}
+
+type TxOption func(o *txOptions)
+
+type txOptions struct {
+	retry *RetryPolicy
+}
+
+// TxWithRetry 事务因为死锁等错误失败时按照 policy 重试
+func TxWithRetry(policy RetryPolicy) TxOption {
+	return func(o *txOptions) {
+		o.retry = &policy
+	}
+}
+
+// DefaultRetryable 同时识别 MySQL、PostgreSQL 和 sqlite3 的可重试错误，
+// 以及方言翻译出来的 ErrDeadlock 和 ErrSerializationFailure
+func DefaultRetryable(err error) bool {
+	return errors.Is(err, ErrDeadlock) || errors.Is(err, ErrSerializationFailure) ||
+		MySQLRetryable(err) || PostgresRetryable(err) || SQLite3Retryable(err)
+}
+
+// MySQLRetryable 识别 MySQL 的死锁(1213)和锁等待超时(1205)
+func MySQLRetryable(err error) bool {
+	code, ok := driverErrCode(err, mysqlDriverPkg, "MySQLError", "Number")
+	return ok && (code == 1213 || code == 1205)
+}
+
+// PostgresRetryable 识别 PostgreSQL 的序列化失败(40001)和死锁(40P01)
+func PostgresRetryable(err error) bool {
+	code, _, _, ok := postgresErr(err)
+	return ok && (code == "40001" || code == "40P01")
+}
+
+// SQLite3Retryable 识别 sqlite3 的 SQLITE_BUSY 和 SQLITE_LOCKED
+func SQLite3Retryable(err error) bool {
+	code, ok := driverErrCode(err, "go-sqlite3", "Error", "Code")
+	return ok && (code == 5 || code == 6)
+}
+
+// driverErrCode 通过反射读取驱动错误里面的错误码，这样不需要依赖具体的驱动
+// pkg 不为空时要求错误类型所在的包以 pkg 结尾
+func driverErrCode(err error, pkg, typeName, field string) (int64, bool) {
+	val, _, ok := driverErr(err, pkg, typeName)
+	if !ok {
+		return 0, false
+	}
+
+	fd := val.FieldByName(field)
+	switch fd.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fd.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(fd.Uint()), true
+	default:
+		return 0, false
+	}
+}
+
+// driverErr 在 err 的错误链中找到类型名为 typeName 的驱动错误，返回它的结构体和错误本身
+func driverErr(err error, pkg, typeName string) (reflect.Value, error, bool) {
+	if err == nil {
+		return reflect.Value{}, nil, false
+	}
+
+	val := reflect.ValueOf(err)
+	if val.Kind() == reflect.Pointer && !val.IsNil() {
+		val = val.Elem()
+	}
+
+	typ := val.Type()
+	if val.Kind() == reflect.Struct && typ.Name() == typeName && strings.HasSuffix(typ.PkgPath(), pkg) {
+		return val, err, true
+	}
+
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return driverErr(e.Unwrap(), pkg, typeName)
+	case interface{ Unwrap() []error }:
+		for _, sub := range e.Unwrap() {
+			if val, de, ok := driverErr(sub, pkg, typeName); ok {
+				return val, de, true
+			}
+		}
+	}
+
+	return reflect.Value{}, nil, false
+}
+
+// driverErrString 读取驱动错误中字符串类型的字段，字段不存在时返回空
+func driverErrString(val reflect.Value, field string) string {
+	fd := val.FieldByName(field)
+	if fd.Kind() != reflect.String {
+		return ""
+	}
+	return fd.String()
+}
+
+// doTxWithRetry 按照 policy 重试整个事务，等待期间 ctx 被取消时返回
+func doTxWithRetry(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= policy.MaxAttempts || !policy.retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(policy.wait(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// MySQLError 和 go-sql-driver/mysql 的错误结构一致，但是不在驱动的包里面
+type MySQLError struct {
+	Number  uint16
+	Message string
+}
+
+func (m *MySQLError) Error() string {
+	return fmt.Sprintf("Error %d: %s", m.Number, m.Message)
+}
+
+func TestRetryable(t *testing.T) {
+	testCases := []struct {
+		name      string
+		err       error
+		retryable func(err error) bool
+		want      bool
+	}{
+		{
+			name:      "mysql deadlock",
+			err:       &mysql.MySQLError{Number: 1213, Message: "Deadlock found"},
+			retryable: MySQLRetryable,
+			want:      true,
+		},
+		{
+			name:      "mysql lock wait timeout wrapped",
+			err:       fmt.Errorf("update order: %w", &mysql.MySQLError{Number: 1205}),
+			retryable: MySQLRetryable,
+			want:      true,
+		},
+		{
+			name:      "mysql duplicate entry",
+			err:       &mysql.MySQLError{Number: 1062},
+			retryable: MySQLRetryable,
+		},
+		{
+			// 只认驱动包里面的 MySQLError
+			name:      "mysql lookalike",
+			err:       &MySQLError{Number: 1213, Message: "Deadlock found"},
+			retryable: MySQLRetryable,
+		},
+		{
+			name:      "postgres serialization failure",
+			err:       &PgError{Code: "40001"},
+			retryable: PostgresRetryable,
+			want:      true,
+		},
+		{
+			name:      "postgres deadlock wrapped",
+			err:       fmt.Errorf("commit: %w", &PgError{Code: "40P01"}),
+			retryable: PostgresRetryable,
+			want:      true,
+		},
+		{
+			name:      "postgres unique violation",
+			err:       &PgError{Code: "23505"},
+			retryable: PostgresRetryable,
+		},
+		{
+			name:      "default postgres",
+			err:       &PgError{Code: "40001"},
+			retryable: DefaultRetryable,
+			want:      true,
+		},
+		{
+			name:      "default translated serialization failure",
+			err:       Postgres.translateErr(&PgError{Code: "40001"}),
+			retryable: DefaultRetryable,
+			want:      true,
+		},
+		{
+			name:      "sqlite3 busy",
+			err:       sqlite3.Error{Code: sqlite3.ErrBusy},
+			retryable: SQLite3Retryable,
+			want:      true,
+		},
+		{
+			name:      "sqlite3 locked joined",
+			err:       errors.Join(sqlite3.Error{Code: sqlite3.ErrLocked}, errors.New("rollback error")),
+			retryable: SQLite3Retryable,
+			want:      true,
+		},
+		{
+			name:      "sqlite3 constraint",
+			err:       sqlite3.Error{Code: sqlite3.ErrConstraint},
+			retryable: SQLite3Retryable,
+		},
+		{
+			name:      "default",
+			err:       sqlite3.Error{Code: sqlite3.ErrBusy},
+			retryable: DefaultRetryable,
+			want:      true,
+		},
+		{
+			name:      "other error",
+			err:       errors.New("other error"),
+			retryable: DefaultRetryable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.retryable(tc.err))
+		})
+	}
+}
+
+func TestRetryPolicy_wait(t *testing.T) {
+	policy := RetryPolicy{
+		Backoff:    10 * time.Millisecond,
+		MaxBackoff: 30 * time.Millisecond,
+	}
+
+	for attempt, want := range map[int]time.Duration{
+		1: 10 * time.Millisecond,
+		2: 20 * time.Millisecond,
+		3: 30 * time.Millisecond,
+		8: 30 * time.Millisecond,
+	} {
+		wait := policy.wait(attempt)
+		assert.GreaterOrEqual(t, wait, want/2)
+		assert.LessOrEqual(t, wait, want)
+	}
+}
+
+func TestDB_DoTxRetry(t *testing.T) {
+	busyErr := sqlite3.Error{Code: sqlite3.ErrBusy}
+
+	testCases := []struct {
+		name         string
+		policy       RetryPolicy
+		failures     int
+		err          error
+		wantAttempts int
+		wantErr      error
+	}{
+		{
+			name:         "retry then commit",
+			policy:       RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+			failures:     2,
+			err:          busyErr,
+			wantAttempts: 3,
+		},
+		{
+			name:         "exceed max attempts",
+			policy:       RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond},
+			failures:     2,
+			err:          busyErr,
+			wantAttempts: 2,
+			wantErr:      busyErr,
+		},
+		{
+			name:         "not retryable",
+			policy:       RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+			failures:     1,
+			err:          errors.New("biz error"),
+			wantAttempts: 1,
+			wantErr:      errors.New("biz error"),
+		},
+		{
+			name: "custom classifier",
+			policy: RetryPolicy{
+				MaxAttempts: 3,
+				Retryable: func(err error) bool {
+					return err.Error() == "biz error"
+				},
+			},
+			failures:     1,
+			err:          errors.New("biz error"),
+			wantAttempts: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = mockDB.Close() }()
+
+			db, err := OpenDB(mockDB)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < tc.wantAttempts; i++ {
+				mock.ExpectBegin()
+				if i < tc.failures {
+					mock.ExpectRollback()
+				} else {
+					mock.ExpectCommit()
+				}
+			}
+
+			attempts := 0
+			err = db.DoTx(context.Background(), nil, func(ctx context.Context, tx *Tx) error {
+				attempts++
+				if attempts <= tc.failures {
+					return tc.err
+				}
+				return nil
+			}, TxWithRetry(tc.policy))
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantAttempts, attempts)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestDB_DoTxRetryCanceled(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = mockDB.Close() }()
+
+	db, err := OpenDB(mockDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	busyErr := sqlite3.Error{Code: sqlite3.ErrBusy}
+	err = db.DoTx(ctx, nil, func(ctx context.Context, tx *Tx) error {
+		return busyErr
+	}, TxWithRetry(RetryPolicy{MaxAttempts: 3, Backoff: time.Hour}))
+	assert.ErrorIs(t, err, busyErr)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
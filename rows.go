@@ -0,0 +1,61 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"github.com/uzziahlin/orm/model"
+	"time"
+)
+
+// Rows Iterate 返回的结果集，和 sql.Rows 一样先调用 Next 再调用 Scan，用完之后必须 Close 释放连接。
+// Scan 和 Err 返回的错误与 Get 一致，经过方言翻译并包装成 *QueryError
+type Rows[T any] struct {
+	ctx  context.Context
+	rows *sql.Rows
+	s    *Builder
+	qc   *QueryContext
+	meta *model.Model
+	// start 开始执行查询的时间，读取过程中出错时计算 QueryError 的耗时
+	start time.Time
+}
+
+// Next 准备下一行，没有更多数据或者出错时返回 false，这时连接已经释放，出错的原因通过 Err 获取
+func (r *Rows[T]) Next() bool {
+	return r.rows.Next()
+}
+
+// Scan 把当前行映射成 T，模型实现了 AfterFindHook 时会执行钩子
+func (r *Rows[T]) Scan() (*T, error) {
+	tp := new(T)
+
+	err := r.s.creator(tp, r.meta).SetColumns(r.rows)
+
+	if err == nil && r.meta.Hooks.Has(model.HookAfterFind) {
+		err = any(tp).(AfterFindHook).AfterFind(r.ctx)
+	}
+
+	if err != nil {
+		return nil, r.queryError(err)
+	}
+
+	return tp, nil
+}
+
+// Err 返回遍历过程中出现的错误
+func (r *Rows[T]) Err() error {
+	if err := r.rows.Err(); err != nil {
+		return r.queryError(err)
+	}
+	return nil
+}
+
+// Close 释放连接并执行 middleware 通过 QueryContext.Defer 注册的方法，可以重复调用
+func (r *Rows[T]) Close() error {
+	err := r.rows.Close()
+	r.qc.release()
+	return err
+}
+
+func (r *Rows[T]) queryError(err error) error {
+	return r.s.queryError(r.qc, r.s.dialect.translateErr(err), time.Since(r.start))
+}
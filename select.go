@@ -3,9 +3,11 @@ package orm
 import (
 	"context"
 	"github.com/uzziahlin/orm/internal/errs"
+	"github.com/uzziahlin/orm/model"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Selectable interface {
@@ -21,6 +23,10 @@ type Selector[T any] struct {
 	orderCols  []Column
 	offset     int
 	limit      int
+	// cacheTTL 调用 WithCache 开启缓存
+	cacheTTL time.Duration
+	// singleflight 调用 WithSingleflight 合并相同的并发查询
+	singleflight bool
 }
 
 func NewSelector[T any](sess Session) *Selector[T] {
@@ -77,6 +83,30 @@ func (s *Selector[T]) Limit(limit int) *Selector[T] {
 	return s
 }
 
+// Use 添加只作用于这一次查询的 middleware，它们包在 DBWithMiddlewares 设置的 middleware 外面
+func (s *Selector[T]) Use(mdls ...MiddleWare) *Selector[T] {
+	s.mdls = append(s.mdls, mdls...)
+	return s
+}
+
+// WithCache 查询结果缓存 ttl，需要配合缓存 middleware 使用
+func (s *Selector[T]) WithCache(ttl time.Duration) *Selector[T] {
+	s.cacheTTL = ttl
+	return s
+}
+
+// WithSingleflight 合并相同的并发查询，需要配合 singleflight middleware 使用
+func (s *Selector[T]) WithSingleflight() *Selector[T] {
+	s.singleflight = true
+	return s
+}
+
+// AllowFullTable 允许在大表上执行没有 LIMIT 的查询
+func (s *Selector[T]) AllowFullTable() *Selector[T] {
+	s.allowFullTable = true
+	return s
+}
+
 func (s *Selector[T]) Build() (*Stat, error) {
 
 	defer func() {
@@ -129,10 +159,20 @@ func (s *Selector[T]) Build() (*Stat, error) {
 		s.buildLimit()
 	}
 
-	return &Stat{
+	stat := &Stat{
 		Sql:  s.builder.String(),
 		Args: s.args,
-	}, nil
+	}
+
+	if err := s.checkFullTable(OpSelect, s, stat); err != nil {
+		return nil, err
+	}
+
+	return stat, nil
+}
+
+func (s *Selector[T]) fullTable(meta *model.Model) bool {
+	return !s.allowFullTable && meta.Large && s.limit <= 0
 }
 
 func (s *Selector[T]) init() error {
@@ -148,112 +188,95 @@ func (s *Selector[T]) init() error {
 	}
 
 	s.builder = &strings.Builder{}
+	s.tables = nil
 
 	return nil
 }
 
+// Get 只读取一行，没有设置 Limit 时加上 LIMIT 1
 func (s *Selector[T]) Get(ctx context.Context) (*T, error) {
-	root := s.handler()
-
-	for _, md := range s.mdls {
-		root = md(root)
-	}
-
-	qc := &QueryContext{
-		Type:    "SELECT",
-		builder: s,
-		model:   s.meta,
+	if s.limit <= 0 {
+		s.limit = 1
+		defer func() {
+			s.limit = 0
+		}()
 	}
 
-	res := root(ctx, qc)
+	qc, err := s.queryContext()
 
-	if res.err != nil {
-		return nil, res.err
+	if err != nil {
+		return nil, err
 	}
 
-	return res.Result.(*T), nil
-}
-
-func (s *Selector[T]) handler() HandleFunc {
-	return func(ctx context.Context, qc *QueryContext) *QueryResult {
-		stat, err := qc.Query()
-
-		if err != nil {
-			return &QueryResult{
-				Result: nil,
-				err:    err,
-			}
-		}
-
-		rows, err := s.sess.QueryContext(ctx, stat.Sql, stat.Args...)
-
-		if err != nil {
-			return &QueryResult{
-				Result: nil,
-				err:    err,
-			}
-		}
-
-		if !rows.Next() {
-			return &QueryResult{
-				Result: nil,
-				err:    err,
-			}
-		}
-
-		tp := new(T)
-		meta, err := s.registry.Get(tp)
-		if err != nil {
-			return &QueryResult{
-				Result: nil,
-				err:    err,
-			}
-		}
-
-		val := s.creator(tp, meta)
-		err = val.SetColumns(rows)
-
-		return &QueryResult{
-			Result: tp,
-			err:    err,
-		}
-	}
+	return get[T](ctx, &s.Builder, qc)
 }
 
 func (s *Selector[T]) GetMulti(ctx context.Context) ([]*T, error) {
-	stat, err := s.Build()
+	qc, err := s.queryContext()
 
 	if err != nil {
 		return nil, err
 	}
 
-	rows, err := s.sess.QueryContext(ctx, stat.Sql, stat.Args...)
+	return getMulti[T](ctx, &s.Builder, qc)
+}
+
+// Iterate 执行查询，返回的 Rows 逐行读取结果，适合导出这类结果集很大的场景，用完之后必须调用 Close。
+// 结果没有读取完，WithCache 和 WithSingleflight 不生效。
+// 读取过程中一直使用 ctx，ctx 取消时 database/sql 会关闭结果集，所以 ctx 要保持有效直到 Close。
+// middleware 派生出来的 ctx 同样如此，它们应该通过 QueryContext.Defer 而不是 defer 取消
+func (s *Selector[T]) Iterate(ctx context.Context) (*Rows[T], error) {
+	qc, err := s.queryContext()
 
 	if err != nil {
 		return nil, err
 	}
 
-	tp := new(T)
+	return iterate[T](ctx, &s.Builder, qc)
+}
 
-	meta, err := s.registry.Get(tp)
+// Each 逐行读取结果交给 fn，fn 返回 error 时停止读取并返回这个 error，结束时总会释放连接。
+// ctx 的要求和 Iterate 一样，要覆盖整个读取过程
+func (s *Selector[T]) Each(ctx context.Context, fn func(*T) error) error {
+	rows, err := s.Iterate(ctx)
 
-	val := s.creator(tp, meta)
+	if err != nil {
+		return err
+	}
 
-	res := make([]*T, 0)
+	defer func() {
+		_ = rows.Close()
+	}()
 
 	for rows.Next() {
-		err = val.SetColumns(rows)
-
+		tp, err := rows.Scan()
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if err = fn(tp); err != nil {
+			return err
 		}
+	}
+
+	return rows.Err()
+}
+
+func (s *Selector[T]) queryContext() (*QueryContext, error) {
+	var t T
 
-		t := new(T)
-		*t = *tp
-		res = append(res, t)
+	meta, err := s.registry.Get(&t)
+
+	if err != nil {
+		return nil, err
 	}
 
-	return res, nil
+	return &QueryContext{
+		Type:         OpSelect,
+		builder:      s,
+		Model:        meta,
+		cacheTTL:     s.cacheTTL,
+		singleflight: s.singleflight,
+	}, nil
 }
 
 func (s *Selector[T]) bindResult(tp *T, cols []string) ([]any, error) {
@@ -293,13 +316,13 @@ func (s *Selector[T]) BuildTable(table TableReference) error {
 		if err != nil {
 			return err
 		}
-		s.quote(meta.TabName)
+		s.quoteTable(meta.TabName)
 		if tab.alias != "" {
 			s.builder.WriteString(" AS ")
 			s.quote(tab.alias)
 		}
 	case nil:
-		s.quote(s.meta.TabName)
+		s.quoteTable(s.meta.TabName)
 	case Join:
 		err := s.BuildTable(tab.left)
 		if err != nil {
@@ -369,7 +392,7 @@ func (s *Selector[T]) buildSelect() error {
 				return err
 			}
 		case RawExpr:
-			s.builder.WriteString(elem.exp)
+			s.buildRaw(elem)
 		}
 	}
 
@@ -0,0 +1,36 @@
+//go:build go1.23
+
+package orm
+
+import (
+	"context"
+	"iter"
+)
+
+// All 返回逐行读取结果的迭代器，配合 for range 使用，提前 break 或者出错时都会释放连接。
+// 出错时 yield 的实体为 nil，迭代随即结束。ctx 的要求和 Iterate 一样，要覆盖整个循环
+func (s *Selector[T]) All(ctx context.Context) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		rows, err := s.Iterate(ctx)
+
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		defer func() {
+			_ = rows.Close()
+		}()
+
+		for rows.Next() {
+			tp, err := rows.Scan()
+			if !yield(tp, err) || err != nil {
+				return
+			}
+		}
+
+		if err = rows.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
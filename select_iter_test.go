@@ -0,0 +1,55 @@
+//go:build go1.23
+
+package orm
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSelector_All(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	newRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"name", "age", "test_field"}).
+			AddRow([]byte("Jack"), []byte("18"), []byte("test")).
+			AddRow([]byte("Tom"), []byte("17"), []byte("test1"))
+	}
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(newRows()).RowsWillBeClosed()
+	var res []*TestModel
+	for tm, err := range NewSelector[TestModel](db).All(ctx) {
+		require.NoError(t, err)
+		res = append(res, tm)
+	}
+	assert.Equal(t, []*TestModel{
+		{Name: "Jack", Age: 18, TestField: "test"},
+		{Name: "Tom", Age: 17, TestField: "test1"},
+	}, res)
+
+	// 提前 break 也会释放连接
+	mock.ExpectQuery("SELECT .*").WillReturnRows(newRows()).RowsWillBeClosed()
+	for tm, err := range NewSelector[TestModel](db).All(ctx) {
+		require.NoError(t, err)
+		assert.Equal(t, "Jack", tm.Name)
+		break
+	}
+
+	mock.ExpectQuery("SELECT .*").WillReturnError(errors.New("invalid query"))
+	for tm, err := range NewSelector[TestModel](db).All(ctx) {
+		assert.Nil(t, tm)
+		assert.Equal(t, errors.New("invalid query"), queryErrCause(err))
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
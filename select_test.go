@@ -6,13 +6,14 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/uzziahlin/orm/internal/errs"
 	"testing"
 )
 
 func TestSelector_Build(t *testing.T) {
 
-	db := memoryDB(t)
+	db := memoryDB(t, DBWithDialect(MySQL))
 
 	testCases := []struct {
 		name string
@@ -65,6 +66,103 @@ func TestSelector_Build(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "where OR",
+
+			sb: NewSelector[TestModel](db).Where(C("Name").EQ("Jack").OR(C("Age").GT(18))),
+
+			wantStat: &Stat{
+				Sql:  "SELECT * FROM `test_model` WHERE (`name` =  ? ) OR (`age` >  ? )",
+				Args: []any{"Jack", 18},
+			},
+		},
+		{
+			name: "where NE",
+
+			sb: NewSelector[TestModel](db).Where(C("Name").NE("Jack")),
+
+			wantStat: &Stat{
+				Sql:  "SELECT * FROM `test_model` WHERE `name` !=  ? ",
+				Args: []any{"Jack"},
+			},
+		},
+		{
+			name: "where LIKE",
+
+			sb: NewSelector[TestModel](db).Where(C("Name").Like("J%").AND(C("TestField").NotLike("%t"))),
+
+			wantStat: &Stat{
+				Sql:  "SELECT * FROM `test_model` WHERE (`name` LIKE  ? ) AND (`test_field` NOT LIKE  ? )",
+				Args: []any{"J%", "%t"},
+			},
+		},
+		{
+			name: "where BETWEEN",
+
+			sb: NewSelector[TestModel](db).Where(C("Age").Between(18, 30)),
+
+			wantStat: &Stat{
+				Sql:  "SELECT * FROM `test_model` WHERE `age` BETWEEN  ?  AND  ? ",
+				Args: []any{18, 30},
+			},
+		},
+		{
+			name: "where IS NULL",
+
+			sb: NewSelector[TestModel](db).Where(C("Name").IsNull().OR(C("TestField").IsNotNull())),
+
+			wantStat: &Stat{
+				Sql: "SELECT * FROM `test_model` WHERE (`name` IS NULL) OR (`test_field` IS NOT NULL)",
+			},
+		},
+		{
+			name: "where IN",
+
+			sb: NewSelector[TestModel](db).Where(C("Age").In(18, 19, 20)),
+
+			wantStat: &Stat{
+				Sql:  "SELECT * FROM `test_model` WHERE `age` IN (?,?,?)",
+				Args: []any{18, 19, 20},
+			},
+		},
+		{
+			name: "where IN slice",
+
+			sb: NewSelector[TestModel](db).Where(C("Name").In([]string{"Jack", "Tom"})),
+
+			wantStat: &Stat{
+				Sql:  "SELECT * FROM `test_model` WHERE `name` IN (?,?)",
+				Args: []any{"Jack", "Tom"},
+			},
+		},
+		{
+			name: "where NOT IN",
+
+			sb: NewSelector[TestModel](db).Where(C("Age").NotIn([]int{18, 19})),
+
+			wantStat: &Stat{
+				Sql:  "SELECT * FROM `test_model` WHERE `age` NOT IN (?,?)",
+				Args: []any{18, 19},
+			},
+		},
+		{
+			name: "where empty IN",
+
+			sb: NewSelector[TestModel](db).Where(C("Age").In([]int{})),
+
+			wantErr: errs.ErrEmptyValueList,
+		},
+		{
+			name: "having aggregate",
+
+			sb: NewSelector[TestModel](db).Select(C("Name"), Avg("Age")).GroupBy(C("Name")).
+				Having(Avg("Age").Between(18, 30).AND(Count("Age").In(1, 2)).AND(Max("Age").NE(60))),
+
+			wantStat: &Stat{
+				Sql:  "SELECT `name`,AVG(`age`) FROM `test_model` GROUP BY `name` HAVING ((AVG(`age`) BETWEEN  ?  AND  ? ) AND (COUNT(`age`) IN (?,?))) AND (MAX(`age`) !=  ? )",
+				Args: []any{18, 30, 1, 2, 60},
+			},
+		},
 		{
 			name: "unknown Field",
 
@@ -286,17 +384,17 @@ func TestSelector_Get(t *testing.T) {
 			name:    "query error",
 			mockErr: errors.New("invalid query"),
 			wantErr: errors.New("invalid query"),
-			query:   "select .*",
+			query:   "SELECT .*",
 		},
 		{
 			name:     "no row",
 			wantErr:  errs.ErrEmptyResult,
-			query:    "select .*",
+			query:    "SELECT .*",
 			mockRows: sqlmock.NewRows([]string{"name"}),
 		},
 		{
 			name:  "get data",
-			query: "select .*",
+			query: "SELECT .*",
 			mockRows: func() *sqlmock.Rows {
 				res := sqlmock.NewRows([]string{"name", "age", "test_field"})
 				res.AddRow([]byte("Jack"), []byte("18"), []byte("test"))
@@ -322,7 +420,7 @@ func TestSelector_Get(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			res, err := NewSelector[TestModel](db).Get(context.Background())
-			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantErr, queryErrCause(err))
 			if err != nil {
 				return
 			}
@@ -356,7 +454,7 @@ func TestSelector_GetMulti(t *testing.T) {
 	}{
 		{
 			name:  "test multi",
-			query: "select .*",
+			query: "SELECT .*",
 			mockRows: func() *sqlmock.Rows {
 				res := sqlmock.NewRows([]string{"name", "age", "test_field"})
 				res.AddRow([]byte("Jack"), []byte("18"), []byte("test"))
@@ -394,6 +492,18 @@ func TestSelector_GetMulti(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "rows error",
+			query: "SELECT .*",
+			mockRows: func() *sqlmock.Rows {
+				res := sqlmock.NewRows([]string{"name", "age", "test_field"})
+				res.AddRow([]byte("Jack"), []byte("18"), []byte("test"))
+				res.AddRow([]byte("Tom"), []byte("17"), []byte("test1"))
+				res.RowError(1, errors.New("rows error"))
+				return res
+			}(),
+			wantErr: errors.New("rows error"),
+		},
 	}
 
 	for _, tc := range testCases {
@@ -401,14 +511,14 @@ func TestSelector_GetMulti(t *testing.T) {
 		if tc.mockErr != nil {
 			exp.WillReturnError(tc.mockErr)
 		} else {
-			exp.WillReturnRows(tc.mockRows)
+			exp.WillReturnRows(tc.mockRows).RowsWillBeClosed()
 		}
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			res, err := NewSelector[TestModel](db).GetMulti(context.Background())
-			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantErr, queryErrCause(err))
 			if err != nil {
 				return
 			}
@@ -417,3 +527,101 @@ func TestSelector_GetMulti(t *testing.T) {
 	}
 
 }
+
+func TestSelector_Iterate(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"name", "age", "test_field"}).
+		AddRow([]byte("Jack"), []byte("18"), []byte("test")).
+		AddRow([]byte("Tom"), []byte("17"), []byte("test1"))).RowsWillBeClosed()
+
+	rows, err := NewSelector[TestModel](db).Iterate(ctx)
+	require.NoError(t, err)
+
+	var res []*TestModel
+	for rows.Next() {
+		tm, err := rows.Scan()
+		require.NoError(t, err)
+		res = append(res, tm)
+	}
+	assert.NoError(t, rows.Err())
+	assert.NoError(t, rows.Close())
+	assert.Equal(t, []*TestModel{
+		{Name: "Jack", Age: 18, TestField: "test"},
+		{Name: "Tom", Age: 17, TestField: "test1"},
+	}, res)
+
+	// 执行失败
+	mock.ExpectQuery("SELECT .*").WillReturnError(errors.New("invalid query"))
+	_, err = NewSelector[TestModel](db).Iterate(ctx)
+	assert.Equal(t, errors.New("invalid query"), queryErrCause(err))
+
+	// 读取过程中出错，Err 返回的错误同样包装成 QueryError
+	mock.ExpectQuery("SELECT .*").WillReturnRows(sqlmock.NewRows([]string{"name", "age", "test_field"}).
+		AddRow([]byte("Jack"), []byte("18"), []byte("test")).
+		AddRow([]byte("Tom"), []byte("17"), []byte("test1")).
+		RowError(1, errors.New("rows error"))).RowsWillBeClosed()
+
+	rows, err = NewSelector[TestModel](db).Iterate(ctx)
+	require.NoError(t, err)
+	for rows.Next() {
+		_, err = rows.Scan()
+		require.NoError(t, err)
+	}
+	var qe *QueryError
+	require.True(t, errors.As(rows.Err(), &qe))
+	assert.Equal(t, "SELECT * FROM `test_model`", qe.Stat.Sql)
+	assert.Equal(t, errors.New("rows error"), qe.Err)
+	assert.NoError(t, rows.Close())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSelector_Each(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	newRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"name", "age", "test_field"}).
+			AddRow([]byte("Jack"), []byte("18"), []byte("test")).
+			AddRow([]byte("Tom"), []byte("17"), []byte("test1")).
+			AddRow([]byte("Ken"), []byte("29"), []byte("test11"))
+	}
+
+	mock.ExpectQuery("SELECT .*").WillReturnRows(newRows()).RowsWillBeClosed()
+	var names []string
+	err = NewSelector[TestModel](db).Each(ctx, func(tm *TestModel) error {
+		names = append(names, tm.Name)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Jack", "Tom", "Ken"}, names)
+
+	// fn 返回 error 时停止读取，连接同样会释放
+	stop := errors.New("stop")
+	mock.ExpectQuery("SELECT .*").WillReturnRows(newRows()).RowsWillBeClosed()
+	names = nil
+	err = NewSelector[TestModel](db).Each(ctx, func(tm *TestModel) error {
+		names = append(names, tm.Name)
+		if tm.Name == "Tom" {
+			return stop
+		}
+		return nil
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, []string{"Jack", "Tom"}, names)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
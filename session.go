@@ -20,4 +20,34 @@ type core struct {
 	creator  valuer.Creator
 	dialect  Dialect
 	mdls     []MiddleWare
+	// fullTableGuard 构造语句时拒绝作用于整张表的语句
+	fullTableGuard bool
+	// queryErrorArgs QueryError 中保留参数
+	queryErrorArgs bool
+}
+
+type txKey struct{}
+
+// WithTx 把事务放进 ctx，用同一个 DB 构造的 Selector、Inserter 等执行时会自动使用这个事务
+func WithTx(ctx context.Context, tx *Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// TxFromContext 取出 WithTx 放进 ctx 的事务
+func TxFromContext(ctx context.Context) (*Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(*Tx)
+	return tx, ok
+}
+
+// resolveSession sess 是 DB 并且 ctx 里面有这个 DB 开启的事务时，使用事务执行
+func resolveSession(ctx context.Context, sess Session) Session {
+	db, ok := sess.(*DB)
+	if !ok {
+		return sess
+	}
+	tx, ok := TxFromContext(ctx)
+	if ok && tx.db == db {
+		return tx
+	}
+	return sess
 }
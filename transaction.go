@@ -3,11 +3,29 @@ package orm
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
 type Tx struct {
 	tx *sql.Tx
 	db *DB
+	// parent 不为 nil 时这是一个通过保存点实现的嵌套事务
+	parent    *Tx
+	savepoint string
+	// seq 最外层事务用来给保存点编号
+	seq atomic.Int64
+	// ctx 开启事务时的 ctx，执行钩子以及释放、回滚保存点时使用
+	ctx context.Context
+	// done 事务已经结束，钩子不会再执行
+	done       bool
+	onCommit   []func(ctx context.Context)
+	onRollback []func(ctx context.Context)
+	// children 通过 BeginTx 开启的嵌套事务，t 结束时接管其中还没有结束的嵌套事务的钩子
+	mu       sync.Mutex
+	children []*Tx
 }
 
 func (t *Tx) getCore() core {
@@ -21,3 +39,166 @@ func (t *Tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.
 func (t *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
 	return t.tx.ExecContext(ctx, query, args...)
 }
+
+// BeginTx 开启嵌套事务，通过 SAVEPOINT 实现，回滚嵌套事务只会撤销它自己的修改
+func (t *Tx) BeginTx(ctx context.Context) (*Tx, error) {
+	name := "sp_" + strconv.FormatInt(t.root().seq.Add(1), 10)
+
+	_, err := t.tx.ExecContext(ctx, t.getCore().dialect.savepoint(name))
+	if err != nil {
+		return nil, err
+	}
+
+	child := &Tx{
+		tx:        t.tx,
+		db:        t.db,
+		parent:    t,
+		savepoint: name,
+		ctx:       ctx,
+	}
+
+	t.mu.Lock()
+	t.children = append(t.children, child)
+	t.mu.Unlock()
+
+	return child, nil
+}
+
+// DoTx 在嵌套事务中执行 fn，规则和 DB.DoTx 一致
+func (t *Tx) DoTx(ctx context.Context, fn func(ctx context.Context, tx *Tx) error) error {
+	tx, err := t.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	return doTx(ctx, tx, fn)
+}
+
+// OnCommit 注册事务提交之后执行的钩子，按照注册顺序执行
+// 嵌套事务里面注册的钩子要等到最外层事务提交之后才执行，
+// 外层事务结束时还没有结束的嵌套事务跟随外层事务，它的钩子也交给外层事务
+func (t *Tx) OnCommit(fn func(ctx context.Context)) {
+	t.onCommit = append(t.onCommit, fn)
+}
+
+// OnRollback 注册事务回滚之后执行的钩子，按照注册顺序执行
+// 嵌套事务回滚时立刻执行它自己的钩子，嵌套事务提交后钩子会交给外层事务
+func (t *Tx) OnRollback(fn func(ctx context.Context)) {
+	t.onRollback = append(t.onRollback, fn)
+}
+
+// Commit 提交事务，嵌套事务只释放保存点，真正的提交由最外层事务完成。
+// 嵌套事务已经结束时返回 sql.ErrTxDone
+func (t *Tx) Commit() error {
+	if t.parent != nil {
+		if t.done {
+			return sql.ErrTxDone
+		}
+		_, err := t.tx.ExecContext(t.ctx, t.getCore().dialect.releaseSavepoint(t.savepoint))
+		if err != nil {
+			return err
+		}
+		t.done = true
+		t.adoptChildren()
+		t.parent.onCommit = append(t.parent.onCommit, t.onCommit...)
+		t.parent.onRollback = append(t.parent.onRollback, t.onRollback...)
+		return nil
+	}
+
+	err := t.tx.Commit()
+	if t.done {
+		return err
+	}
+	t.done = true
+	t.adoptChildren()
+	if err != nil {
+		// 提交失败时事务已经不可用，修改不会生效
+		t.runHooks(t.onRollback)
+		return err
+	}
+	t.runHooks(t.onCommit)
+	return nil
+}
+
+// Rollback 回滚事务，嵌套事务只回滚到它的保存点，已经结束时返回 sql.ErrTxDone
+func (t *Tx) Rollback() error {
+	var err error
+	if t.parent != nil {
+		if t.done {
+			return sql.ErrTxDone
+		}
+		_, err = t.tx.ExecContext(t.ctx, t.getCore().dialect.rollbackToSavepoint(t.savepoint))
+		if err != nil {
+			return err
+		}
+	} else {
+		err = t.tx.Rollback()
+	}
+
+	if t.done {
+		return err
+	}
+	t.done = true
+	t.adoptChildren()
+	t.runHooks(t.onRollback)
+	return err
+}
+
+// adoptChildren 结束还没有结束的嵌套事务，把它们的钩子接到 t 的后面
+func (t *Tx) adoptChildren() {
+	t.mu.Lock()
+	children := t.children
+	t.children = nil
+	t.mu.Unlock()
+
+	for _, child := range children {
+		if child.done {
+			continue
+		}
+		child.done = true
+		child.adoptChildren()
+		t.onCommit = append(t.onCommit, child.onCommit...)
+		t.onRollback = append(t.onRollback, child.onRollback...)
+	}
+}
+
+// runHooks 按顺序执行钩子，钩子 panic 时交给 DB 处理，不影响后面的钩子
+func (t *Tx) runHooks(hooks []func(ctx context.Context)) {
+	for _, hook := range hooks {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.db.txHookPanic(t.ctx, r)
+				}
+			}()
+			hook(t.ctx)
+		}()
+	}
+}
+
+func (t *Tx) root() *Tx {
+	root := t
+	for root.parent != nil {
+		root = root.parent
+	}
+	return root
+}
+
+// doTx fn 返回 nil 时提交 tx，返回 error 时回滚，传给 fn 的 ctx 里面带有 tx
+// fn panic 时先回滚再重新 panic，回滚失败的错误会和 fn 的错误合并返回
+func doTx(ctx context.Context, tx *Tx, fn func(ctx context.Context, tx *Tx) error) error {
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(WithTx(ctx, tx), tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return errors.Join(err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
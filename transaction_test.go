@@ -0,0 +1,556 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+func TestDB_DoTx(t *testing.T) {
+	bizErr := errors.New("biz error")
+	rollbackErr := errors.New("rollback error")
+
+	testCases := []struct {
+		name    string
+		mock    func(mock sqlmock.Sqlmock)
+		fn      func(ctx context.Context, tx *Tx) error
+		wantErr error
+	}{
+		{
+			name: "begin error",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin().WillReturnError(errors.New("begin error"))
+			},
+			fn: func(ctx context.Context, tx *Tx) error {
+				return nil
+			},
+			wantErr: errors.New("begin error"),
+		},
+		{
+			name: "commit",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("DELETE FROM .*").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			fn: func(ctx context.Context, tx *Tx) error {
+				_, err := NewDeleter[TestModel](tx).Where(C("Name").EQ("Jack")).Exec(ctx)
+				return err
+			},
+		},
+		{
+			name: "rollback",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectRollback()
+			},
+			fn: func(ctx context.Context, tx *Tx) error {
+				return bizErr
+			},
+			wantErr: bizErr,
+		},
+		{
+			name: "rollback error",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectRollback().WillReturnError(rollbackErr)
+			},
+			fn: func(ctx context.Context, tx *Tx) error {
+				return bizErr
+			},
+			wantErr: errors.Join(bizErr, rollbackErr),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = mockDB.Close() }()
+
+			db, err := OpenDB(mockDB)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tc.mock(mock)
+
+			err = db.DoTx(context.Background(), nil, tc.fn)
+			assert.Equal(t, tc.wantErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestDB_DoTxPanic(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = mockDB.Close() }()
+
+	db, err := OpenDB(mockDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	assert.PanicsWithValue(t, "biz panic", func() {
+		_ = db.DoTx(context.Background(), nil, func(ctx context.Context, tx *Tx) error {
+			panic("biz panic")
+		})
+	})
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTx_DoTx(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = mockDB.Close() }()
+
+	db, err := OpenDB(mockDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bizErr := errors.New("biz error")
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT sp_3").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("RELEASE SAVEPOINT sp_3").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("RELEASE SAVEPOINT sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err = db.DoTx(context.Background(), nil, func(ctx context.Context, tx *Tx) error {
+		err := tx.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+			return bizErr
+		})
+		assert.Equal(t, bizErr, err)
+
+		return tx.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+			return tx.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+				return nil
+			})
+		})
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTx_NestedDone(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("RELEASE SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+
+	// 已经结束的嵌套事务不会再发送 RELEASE
+	nested, err := tx.BeginTx(ctx)
+	require.NoError(t, err)
+	require.NoError(t, nested.Commit())
+	assert.Equal(t, sql.ErrTxDone, nested.Commit())
+	assert.Equal(t, sql.ErrTxDone, nested.Rollback())
+
+	// 释放保存点使用开启嵌套事务时的 ctx
+	cancelCtx, cancel := context.WithCancel(ctx)
+	nested, err = tx.BeginTx(cancelCtx)
+	require.NoError(t, err)
+	cancel()
+	assert.ErrorIs(t, nested.Commit(), context.Canceled)
+
+	require.NoError(t, tx.Rollback())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTx_BeginTxConcurrent(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+
+	const n = 10
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectBegin()
+	for i := 0; i < n; i++ {
+		mock.ExpectExec("SAVEPOINT sp_.*").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+
+	var (
+		mu    sync.Mutex
+		names = make(map[string]struct{}, n)
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nested, err := tx.BeginTx(ctx)
+			assert.NoError(t, err)
+			mu.Lock()
+			names[nested.savepoint] = struct{}{}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// 每个保存点的名字都不一样
+	assert.Len(t, names, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTx_DoTxSQLite3(t *testing.T) {
+	db, err := Open("sqlite3", "file:tx_savepoint?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE "auto_increment_model"("id" INTEGER PRIMARY KEY AUTOINCREMENT, "name" TEXT)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insert := func(ctx context.Context, tx *Tx, name string) error {
+		_, err := NewInserter[AutoIncrementModel](tx).Values(&AutoIncrementModel{Name: name}).Exec(ctx)
+		return err
+	}
+
+	err = db.DoTx(ctx, nil, func(ctx context.Context, tx *Tx) error {
+		if err := insert(ctx, tx, "Jack"); err != nil {
+			return err
+		}
+
+		err := tx.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+			if err := insert(ctx, tx, "Tom"); err != nil {
+				return err
+			}
+			return errors.New("inner error")
+		})
+		assert.Equal(t, errors.New("inner error"), err)
+
+		return tx.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+			return insert(ctx, tx, "Ken")
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := NewSelector[AutoIncrementModel](db).GetMulti(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []*AutoIncrementModel{{Id: 1, Name: "Jack"}, {Id: 2, Name: "Ken"}}, res)
+}
+
+func TestWithTx(t *testing.T) {
+	db, err := Open("sqlite3", "file:tx_context?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	ctx := context.Background()
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE "auto_increment_model"("id" INTEGER PRIMARY KEY AUTOINCREMENT, "name" TEXT)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 仓储函数只拿到 DB，通过 ctx 使用调用方的事务
+	insert := func(ctx context.Context, name string) error {
+		_, err := NewInserter[AutoIncrementModel](db).Values(&AutoIncrementModel{Name: name}).Exec(ctx)
+		return err
+	}
+
+	err = db.DoTx(ctx, nil, func(ctx context.Context, tx *Tx) error {
+		if err := insert(ctx, "Jack"); err != nil {
+			return err
+		}
+
+		// 已经在事务中，DoTx 会开启嵌套事务
+		err := db.DoTx(ctx, nil, func(ctx context.Context, tx *Tx) error {
+			if err := insert(ctx, "Tom"); err != nil {
+				return err
+			}
+			return errors.New("inner error")
+		})
+		assert.Equal(t, errors.New("inner error"), err)
+
+		res, err := NewSelector[AutoIncrementModel](db).GetMulti(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []*AutoIncrementModel{{Id: 1, Name: "Jack"}}, res)
+
+		return errors.New("outer error")
+	})
+	assert.Equal(t, errors.New("outer error"), err)
+
+	res, err := NewSelector[AutoIncrementModel](db).GetMulti(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []*AutoIncrementModel{}, res)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := TxFromContext(WithTx(ctx, tx))
+	assert.True(t, ok)
+	assert.Equal(t, tx, got)
+	assert.NoError(t, tx.Rollback())
+}
+
+func TestTx_Hooks(t *testing.T) {
+	testCases := []struct {
+		name      string
+		mock      func(mock sqlmock.Sqlmock)
+		fn        func(ctx context.Context, tx *Tx, record func(event string) func(ctx context.Context)) error
+		wantLogs  []string
+		wantPanic []any
+	}{
+		{
+			name: "commit",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectCommit()
+			},
+			fn: func(ctx context.Context, tx *Tx, record func(event string) func(ctx context.Context)) error {
+				tx.OnCommit(record("commit 1"))
+				tx.OnRollback(record("rollback 1"))
+				tx.OnCommit(record("commit 2"))
+				return nil
+			},
+			wantLogs: []string{"commit 1", "commit 2"},
+		},
+		{
+			name: "rollback",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectRollback()
+			},
+			fn: func(ctx context.Context, tx *Tx, record func(event string) func(ctx context.Context)) error {
+				tx.OnCommit(record("commit 1"))
+				tx.OnRollback(record("rollback 1"))
+				tx.OnRollback(record("rollback 2"))
+				return errors.New("biz error")
+			},
+			wantLogs: []string{"rollback 1", "rollback 2"},
+		},
+		{
+			name: "commit error",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectCommit().WillReturnError(errors.New("commit error"))
+			},
+			fn: func(ctx context.Context, tx *Tx, record func(event string) func(ctx context.Context)) error {
+				tx.OnCommit(record("commit 1"))
+				tx.OnRollback(record("rollback 1"))
+				return nil
+			},
+			wantLogs: []string{"rollback 1"},
+		},
+		{
+			name: "panic",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectCommit()
+			},
+			fn: func(ctx context.Context, tx *Tx, record func(event string) func(ctx context.Context)) error {
+				tx.OnCommit(func(ctx context.Context) {
+					panic("hook panic")
+				})
+				tx.OnCommit(record("commit 2"))
+				return nil
+			},
+			wantLogs:  []string{"commit 2"},
+			wantPanic: []any{"hook panic"},
+		},
+		{
+			name: "savepoint",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("ROLLBACK TO SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("SAVEPOINT sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("RELEASE SAVEPOINT sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			fn: func(ctx context.Context, tx *Tx, record func(event string) func(ctx context.Context)) error {
+				tx.OnCommit(record("outer commit"))
+				_ = tx.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+					tx.OnCommit(record("inner 1 commit"))
+					tx.OnRollback(record("inner 1 rollback"))
+					return errors.New("inner error")
+				})
+				return tx.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+					tx.OnCommit(record("inner 2 commit"))
+					tx.OnRollback(record("inner 2 rollback"))
+					return nil
+				})
+			},
+			wantLogs: []string{"inner 1 rollback", "outer commit", "inner 2 commit"},
+		},
+		{
+			name: "savepoint released then rollback",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("RELEASE SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			fn: func(ctx context.Context, tx *Tx, record func(event string) func(ctx context.Context)) error {
+				_ = tx.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+					tx.OnCommit(record("inner commit"))
+					tx.OnRollback(record("inner rollback"))
+					return nil
+				})
+				return errors.New("outer error")
+			},
+			wantLogs: []string{"inner rollback"},
+		},
+		{
+			// 没有结束的嵌套事务跟随外层事务提交
+			name: "unfinished savepoint commit",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("SAVEPOINT sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			fn: func(ctx context.Context, tx *Tx, record func(event string) func(ctx context.Context)) error {
+				tx.OnCommit(record("outer commit"))
+				inner, err := tx.BeginTx(ctx)
+				if err != nil {
+					return err
+				}
+				inner.OnCommit(record("inner commit"))
+				inner.OnRollback(record("inner rollback"))
+				innermost, err := inner.BeginTx(ctx)
+				if err != nil {
+					return err
+				}
+				innermost.OnCommit(record("innermost commit"))
+				return nil
+			},
+			wantLogs: []string{"outer commit", "inner commit", "innermost commit"},
+		},
+		{
+			name: "unfinished savepoint rollback",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			fn: func(ctx context.Context, tx *Tx, record func(event string) func(ctx context.Context)) error {
+				tx.OnRollback(record("outer rollback"))
+				inner, err := tx.BeginTx(ctx)
+				if err != nil {
+					return err
+				}
+				inner.OnCommit(record("inner commit"))
+				inner.OnRollback(record("inner rollback"))
+				return errors.New("outer error")
+			},
+			wantLogs: []string{"outer rollback", "inner rollback"},
+		},
+		{
+			// 回滚到外层保存点时，里面没有结束的嵌套事务也一起回滚
+			name: "unfinished savepoint in rolled back savepoint",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("SAVEPOINT sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("ROLLBACK TO SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			fn: func(ctx context.Context, tx *Tx, record func(event string) func(ctx context.Context)) error {
+				var innermost *Tx
+				_ = tx.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+					var err error
+					innermost, err = tx.BeginTx(ctx)
+					if err != nil {
+						return err
+					}
+					innermost.OnCommit(record("innermost commit"))
+					innermost.OnRollback(record("innermost rollback"))
+					return errors.New("inner error")
+				})
+				// 已经跟随外层结束
+				if err := innermost.Commit(); !errors.Is(err, sql.ErrTxDone) {
+					return fmt.Errorf("want ErrTxDone, got %v", err)
+				}
+				return nil
+			},
+			wantLogs: []string{"innermost rollback"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = mockDB.Close() }()
+
+			var panics []any
+			db, err := OpenDB(mockDB, DBWithTxHookPanicHandler(func(ctx context.Context, r any) {
+				panics = append(panics, r)
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tc.mock(mock)
+
+			var logs []string
+			record := func(event string) func(ctx context.Context) {
+				return func(ctx context.Context) {
+					logs = append(logs, event)
+				}
+			}
+
+			_ = db.DoTx(context.Background(), nil, func(ctx context.Context, tx *Tx) error {
+				return tc.fn(ctx, tx, record)
+			})
+			assert.Equal(t, tc.wantLogs, logs)
+			assert.Equal(t, tc.wantPanic, panics)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -11,7 +11,7 @@ type Querier[T any] interface {
 }
 
 type Executor[T any] interface {
-	Exec() (Result, error)
+	Exec(ctx context.Context) (Result, error)
 }
 
 type Result interface {
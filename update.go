@@ -0,0 +1,176 @@
+package orm
+
+import (
+	"context"
+	"github.com/uzziahlin/orm/internal/errs"
+	"github.com/uzziahlin/orm/model"
+	"strings"
+)
+
+type Updater[T any] struct {
+	Builder
+	val     *T
+	assigns []Assignable
+	where   []Predicate
+}
+
+func NewUpdater[T any](sess Session) *Updater[T] {
+
+	c := sess.getCore()
+
+	builder := Builder{
+		sess:   sess,
+		core:   c,
+		quoter: c.dialect.quoter(),
+	}
+	return &Updater[T]{
+		Builder: builder,
+	}
+}
+
+// Update 指定要更新的实体，Set 中使用 C("FieldName") 时会从这里取值，
+// 执行前在它上面调用 BeforeUpdateHook
+func (u *Updater[T]) Update(entity *T) *Updater[T] {
+	u.val = entity
+	return u
+}
+
+// Set 指定要更新的列
+// Set(C("Name"), Assign("Age", 18))
+func (u *Updater[T]) Set(assigns ...Assignable) *Updater[T] {
+	u.assigns = assigns
+	return u
+}
+
+func (u *Updater[T]) Where(conds ...Predicate) *Updater[T] {
+	u.where = conds
+	return u
+}
+
+// Use 添加只作用于这一次查询的 middleware，它们包在 DBWithMiddlewares 设置的 middleware 外面
+func (u *Updater[T]) Use(mdls ...MiddleWare) *Updater[T] {
+	u.mdls = append(u.mdls, mdls...)
+	return u
+}
+
+// AllowFullTable 允许执行没有 WHERE 的更新
+func (u *Updater[T]) AllowFullTable() *Updater[T] {
+	u.allowFullTable = true
+	return u
+}
+
+func (u *Updater[T]) Build() (*Stat, error) {
+
+	if len(u.assigns) == 0 {
+		return nil, errs.ErrNoUpdatedColumns
+	}
+
+	var (
+		t   T
+		err error
+	)
+
+	u.meta, err = u.registry.Get(&t)
+
+	if err != nil {
+		return nil, err
+	}
+
+	u.builder = &strings.Builder{}
+	u.tables = nil
+
+	defer func() {
+		u.builder.Reset()
+		u.args = nil
+	}()
+
+	u.builder.WriteString("UPDATE ")
+	u.quoteTable(u.meta.TabName)
+	u.builder.WriteString(" SET ")
+
+	if err = u.buildAssigns(); err != nil {
+		return nil, err
+	}
+
+	if len(u.where) > 0 {
+		u.builder.WriteString(" WHERE ")
+		if err = u.BuildPredicates(u.where...); err != nil {
+			return nil, err
+		}
+	}
+
+	stat := &Stat{
+		Sql:  u.builder.String(),
+		Args: u.args,
+	}
+
+	if err = u.checkFullTable(OpUpdate, u, stat); err != nil {
+		return nil, err
+	}
+
+	return stat, nil
+}
+
+func (u *Updater[T]) fullTable(meta *model.Model) bool {
+	return !u.allowFullTable && len(u.where) == 0
+}
+
+func (u *Updater[T]) buildAssigns() error {
+	for idx, a := range u.assigns {
+		if idx > 0 {
+			u.builder.WriteByte(',')
+		}
+		switch assign := a.(type) {
+		case Column:
+			if u.val == nil {
+				return errs.NewErrUnsupportedAssignableType(assign)
+			}
+			if err := u.buildColumn(C(assign.name)); err != nil {
+				return err
+			}
+			val, err := u.creator(u.val, u.meta).GetField(assign.name)
+			if err != nil {
+				return err
+			}
+			u.builder.WriteString("=")
+			if err = u.buildExpression(Value{val: val}); err != nil {
+				return err
+			}
+		case Assignment:
+			if err := u.buildColumn(C(assign.column)); err != nil {
+				return err
+			}
+			u.builder.WriteString("=")
+			if err := u.buildExpression(assign.val); err != nil {
+				return err
+			}
+		default:
+			return errs.NewErrUnsupportedAssignableType(a)
+		}
+	}
+	return nil
+}
+
+func (u *Updater[T]) Exec(ctx context.Context) (Result, error) {
+	var t T
+
+	meta, err := u.registry.Get(&t)
+
+	if err != nil {
+		return nil, err
+	}
+
+	qc := &QueryContext{
+		Type:    OpUpdate,
+		builder: u,
+		Model:   meta,
+	}
+
+	if u.val != nil && meta.Hooks.Has(model.HookBeforeUpdate) {
+		if err = any(u.val).(BeforeUpdateHook).BeforeUpdate(ctx, u.session(ctx)); err != nil {
+			return nil, u.hookError(qc, err)
+		}
+	}
+
+	return u.exec(ctx, qc)
+}
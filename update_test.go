@@ -0,0 +1,148 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzziahlin/orm/internal/errs"
+	"testing"
+)
+
+func TestUpdater_Build(t *testing.T) {
+
+	db := memoryDB(t, DBWithDialect(MySQL))
+
+	testCases := []struct {
+		name     string
+		builder  SQLBuilder
+		wantStat *Stat
+		wantErr  error
+	}{
+		{
+			name:    "no columns",
+			builder: NewUpdater[TestModel](db),
+			wantErr: errs.ErrNoUpdatedColumns,
+		},
+		{
+			name: "column from entity",
+			builder: NewUpdater[TestModel](db).Update(&TestModel{
+				Name: "Jack",
+				Age:  18,
+			}).Set(C("Name"), C("Age")),
+			wantStat: &Stat{
+				Sql: "UPDATE `test_model` SET `name`= ? ,`age`= ? ",
+				Args: []any{
+					"Jack",
+					18,
+				},
+			},
+		},
+		{
+			name:    "column without entity",
+			builder: NewUpdater[TestModel](db).Set(C("Name")),
+			wantErr: errs.NewErrUnsupportedAssignableType(C("Name")),
+		},
+		{
+			name:    "assignment",
+			builder: NewUpdater[TestModel](db).Set(Assign("Name", "Tom"), Assign("Age", Raw("`age` + ?", 1))),
+			wantStat: &Stat{
+				Sql: "UPDATE `test_model` SET `name`= ? ,`age`=`age` + ?",
+				Args: []any{
+					"Tom",
+					1,
+				},
+			},
+		},
+		{
+			name: "where",
+			builder: NewUpdater[TestModel](db).Set(Assign("Age", 19)).
+				Where(C("Name").EQ("Jack").AND(C("Age").LT(18))),
+			wantStat: &Stat{
+				Sql: "UPDATE `test_model` SET `age`= ?  WHERE (`name` =  ? ) AND (`age` <  ? )",
+				Args: []any{
+					19,
+					"Jack",
+					18,
+				},
+			},
+		},
+		{
+			name:    "unknown field",
+			builder: NewUpdater[TestModel](db).Set(Assign("Gender", 1)),
+			wantErr: errs.NewErrUnknownField("Gender"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stat, err := tc.builder.Build()
+
+			assert.Equal(t, tc.wantErr, err)
+
+			if err != nil {
+				return
+			}
+
+			assert.Equal(t, tc.wantStat, stat)
+		})
+	}
+}
+
+func TestUpdater_Exec(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = mockDB.Close() }()
+
+	db, err := OpenDB(mockDB)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name         string
+		mockErr      error
+		mockRes      Result
+		wantErr      error
+		wantAffected int64
+	}{
+		{
+			name:    "exec error",
+			mockErr: errors.New("invalid exec"),
+			wantErr: errors.New("invalid exec"),
+		},
+		{
+			name:         "exec",
+			mockRes:      sqlmock.NewResult(0, 3),
+			wantAffected: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		exp := mock.ExpectExec("UPDATE .*")
+		if tc.mockErr != nil {
+			exp.WillReturnError(tc.mockErr)
+		} else {
+			exp.WillReturnResult(tc.mockRes)
+		}
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := NewUpdater[TestModel](db).Set(Assign("Age", 18)).
+				Where(C("Name").EQ("Jack")).Exec(context.Background())
+			assert.Equal(t, tc.wantErr, queryErrCause(err))
+			if err != nil {
+				return
+			}
+			affected, err := res.RowsAffected()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantAffected, affected)
+		})
+	}
+}